@@ -0,0 +1,158 @@
+// Command devjwt makes a local signing key with its JWKS and mints tokens
+// signed by it, so that JWT authentication can be tried out without an
+// identity provider:
+//
+//	go run ./cmd/devjwt -init -key dev/jwt.pem -jwks dev/jwks.json
+//	go run ./cmd/library-app -jwt-jwks dev/jwks.json
+//	go run ./cmd/devjwt -key dev/jwt.pem -sub alice -roles librarian
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"library-app/pkg/oidc"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	var (
+		initKey  bool
+		keyFile  string
+		jwksFile string
+		sub      string
+		email    string
+		name     string
+		roles    string
+		issuer   string
+		audience string
+		ttl      time.Duration
+	)
+	flag.BoolVar(&initKey, "init", false, "Generate a new signing key and its JWKS instead of a token")
+	flag.StringVar(&keyFile, "key", "jwt.pem", "PEM file holding the signing key")
+	flag.StringVar(&jwksFile, "jwks", "jwks.json", "JWKS file written by -init")
+	flag.StringVar(&sub, "sub", "", "Subject of the token")
+	flag.StringVar(&email, "email", "", "Email claim")
+	flag.StringVar(&name, "name", "", "Name claim")
+	flag.StringVar(&roles, "roles", "", "Comma-separated roles claim")
+	flag.StringVar(&issuer, "iss", "", "Issuer claim")
+	flag.StringVar(&audience, "aud", "", "Audience claim")
+	flag.DurationVar(&ttl, "ttl", time.Hour, "Lifetime of the token")
+	flag.Parse()
+
+	var err error
+	if initKey {
+		err = generate(keyFile, jwksFile)
+	} else {
+		err = mint(keyFile, sub, email, name, roles, issuer, audience, ttl)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func generate(keyFile, jwksFile string) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		return err
+	}
+	kid, err := keyID(key.Public())
+	if err != nil {
+		return err
+	}
+	jwk, err := oidc.NewJWK(key.Public(), kid)
+	if err != nil {
+		return err
+	}
+	js, err := json.MarshalIndent(oidc.JWKS{Keys: []oidc.JWK{jwk}}, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(jwksFile, js, 0644)
+}
+
+func mint(keyFile, sub, email, name, roles, issuer, audience string, ttl time.Duration) error {
+	if sub == "" {
+		return errors.New("-sub must be provided")
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("%s holds no PEM data", keyFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("%s holds no signing key", keyFile)
+	}
+	kid, err := keyID(key.Public())
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"sub": sub,
+		"iat": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+	}
+	if email != "" {
+		claims["email"] = email
+		claims["email_verified"] = true
+	}
+	if name != "" {
+		claims["name"] = name
+	}
+	if roles != "" {
+		claims["roles"] = strings.Split(roles, ",")
+	}
+	if issuer != "" {
+		claims["iss"] = issuer
+	}
+	if audience != "" {
+		claims["aud"] = audience
+	}
+
+	token, err := oidc.Sign(key, kid, claims)
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
+
+// keyID derives a key id from the public key, so that -init and token
+// minting agree on it without storing it anywhere.
+func keyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12]), nil
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"library-app/pkg/jsonpatch"
 	"library-app/pkg/models"
 	"library-app/pkg/validator"
 	"net/http"
@@ -24,8 +26,13 @@ func (app *application) createAuthorHandler(w http.ResponseWriter, r *http.Reque
 		Name: input.Name,
 		Id:   input.Id,
 	}
+	v := validator.New()
+	if models.ValidateAuthor(v, author); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
 
-	err = app.models.Authors.Insert(author)
+	err = app.models.Authors.Insert(r.Context(), author)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -47,7 +54,7 @@ func (app *application) showAuthorHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	author, err := app.models.Authors.Get(id)
+	author, err := app.models.Authors.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrRecordNotFound):
@@ -69,7 +76,7 @@ func (app *application) updateAuthorHandler(w http.ResponseWriter, r *http.Reque
 		app.notFoundResponse(w, r)
 		return
 	}
-	author, err := app.models.Authors.Get(id)
+	author, err := app.models.Authors.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrRecordNotFound):
@@ -88,10 +95,20 @@ func (app *application) updateAuthorHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 	author.Name = input.Name
+	v := validator.New()
+	if models.ValidateAuthor(v, author); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
 
-	err = app.models.Authors.Update(author)
+	err = app.models.Authors.Update(r.Context(), author)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 	err = app.writeJSON(w, http.StatusOK, envelope{"author": author}, nil)
@@ -100,13 +117,13 @@ func (app *application) updateAuthorHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
-func (app *application) deleteAuthorHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) patchAuthorHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
-	err = app.models.Authors.Delete(id)
+	author, err := app.models.Authors.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrRecordNotFound):
@@ -116,38 +133,52 @@ func (app *application) deleteAuthorHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "author successfully deleted"}, nil)
+	var input struct {
+		Name string `json:"name"`
+	}
+	input.Name = author.Name
+	err = app.readPatch(w, r, &input)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, errUnsupportedPatch):
+			app.unsupportedMediaTypeResponse(w, r)
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.patchFailedResponse(w, r, err)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
 	}
-}
-
-func (app *application) listAuthorsHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Name string
-		Id   int64
-		models.Filters
+	author.Name = input.Name
+	v := validator.New()
+	if models.ValidateAuthor(v, author); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 
-	authors, err := app.models.Authors.GetAll(input.Name, input.Id, input.Filters)
+	err = app.models.Authors.Update(r.Context(), author)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
-
-	err = app.writeJSON(w, http.StatusOK, envelope{"authors": authors}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"author": author}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) listBooksByAuthorHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) revertAuthorHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
-	_, err = app.models.Authors.Get(id)
+	author, err := app.models.Authors.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrRecordNotFound):
@@ -157,50 +188,90 @@ func (app *application) listBooksByAuthorHandler(w http.ResponseWriter, r *http.
 		}
 		return
 	}
-
-	var input struct {
-		Title    string
-		Year     int32
-		AuthorId int64
-		Genres   []string
-		models.Filters
+	revision := app.readRevert(w, r, "author", id)
+	if revision == nil {
+		return
+	}
+	err = revertFields(author, revision)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
+	author.Id = id
 	v := validator.New()
+	if models.ValidateAuthor(v, author); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
 
-	qs := r.URL.Query()
-
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
-	input.Filters.Page = app.readInt(qs, "page", 1, v)
-	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	err = app.models.Authors.Update(revertContext(r, revision), author)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"author": author}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
 
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "year", "author", "-id", "-title", "-year", "-author"}
+func (app *application) listAuthorRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	app.listRevisions(w, r, "author", func(ctx context.Context, id int64) error {
+		_, err := app.models.Authors.Get(ctx, id)
+		return err
+	})
+}
 
-	if models.ValidateFilters(v, input.Filters); !v.Valid() {
+func (app *application) deleteAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input models.AuthorDeletion
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Strategy = app.readString(qs, "strategy", models.DeleteRestrict)
+	input.ReassignTo = app.readInt64(qs, "to", 0, v)
+	if models.ValidateAuthorDeletion(v, id, input); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-
-	books, metadata, err := app.models.Books.GetAll(input.Title, input.Genres, input.Filters)
+	works, err := app.models.Authors.Delete(r.Context(), id, input)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrAuthorHasWorks):
+			app.authorHasWorksResponse(w, r, works)
+		case errors.Is(err, models.ErrWorkInCirculation):
+			app.circulationConflictResponse(w, r, err)
+		case errors.Is(err, models.ErrUnknownAuthor):
+			v.AddError("to", "must reference an existing author")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
-
-	err = app.writeJSON(w, http.StatusOK, envelope{"books": books, "metadata": metadata}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "author successfully deleted", "works": works}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) listMangaByAuthorHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) restoreAuthorHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
-	_, err = app.models.Authors.Get(id)
+	author, err := app.models.Authors.Restore(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrRecordNotFound):
@@ -210,38 +281,40 @@ func (app *application) listMangaByAuthorHandler(w http.ResponseWriter, r *http.
 		}
 		return
 	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"author": author}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
 
+func (app *application) listAuthorsHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title    string
-		Year     int32
-		AuthorId int64
-		Genres   []string
+		Name string
 		models.Filters
 	}
 	v := validator.New()
-
 	qs := r.URL.Query()
-
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.Name = app.readString(qs, "name", "")
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
 
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "year", "author", "-id", "-title", "-year", "-author"}
+	input.Filters.SortSafelist = []string{"id", "name", "-id", "-name"}
+	input.Filters.SortTypes = map[string]string{"id": "bigint"}
 
 	if models.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	books, metadata, err := app.models.Books.GetAll(input.Title, input.Genres, input.Filters)
+	authors, metadata, err := app.models.Authors.GetAll(r.Context(), input.Name, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"books": books, "metadata": metadata}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"authors": authors, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -2,131 +2,26 @@ package main
 
 import (
 	"errors"
-	"fmt"
+	"github.com/julienschmidt/httprouter"
 	"library-app/pkg/models"
 	"library-app/pkg/validator"
 	"net/http"
 )
 
-func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title    string   `json:"title"`
-		Year     int32    `json:"year"`
-		AuthorID int64    `json:"author_id"`
-		Genres   []string `json:"genres"`
+// showBookByISBNHandler looks a book up by the ISBN in the URL, as a barcode
+// scanner reads it. An ISBN-10 finds the book by its ISBN-13.
+func (app *application) showBookByISBNHandler(w http.ResponseWriter, r *http.Request) {
+	isbn := validator.NormalizeISBN(httprouter.ParamsFromContext(r.Context()).ByName("isbn"))
+	if validator.ValidISBN10(isbn) {
+		isbn = validator.ISBN10To13(isbn)
 	}
-	err := app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
-	book := &models.Book{
-		Title:    input.Title,
-		Year:     input.Year,
-		AuthorId: input.AuthorID,
-		Genres:   input.Genres,
-	}
-	v := validator.New()
-	if models.ValidateBook(v, book); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
-		return
-	}
-	err = app.models.Books.Insert(book)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/books/%d", book.ID))
-
-	err = app.writeJSON(w, http.StatusCreated, envelope{"book": book}, headers)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-	}
-}
-
-func (app *application) showBookHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.readIDParam(r)
-	if err != nil {
-		app.notFoundResponse(w, r)
-		return
-	}
-	book, err := app.models.Books.Get(id)
-	if err != nil {
-		switch {
-		case errors.Is(err, models.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
-		return
-	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"book": book}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-	}
-}
-
-func (app *application) updateBookHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.readIDParam(r)
-	if err != nil {
-		app.notFoundResponse(w, r)
-		return
-	}
-	book, err := app.models.Books.Get(id)
-	if err != nil {
-		switch {
-		case errors.Is(err, models.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
-		return
-	}
-	var input struct {
-		Title    string   `json:"title"`
-		Year     int32    `json:"year"`
-		AuthorId int64    `json:"author_id"`
-		Genres   []string `json:"genres"`
-	}
-	err = app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
-	book.Title = input.Title
-	book.Year = input.Year
-	book.AuthorId = input.AuthorId
-	book.Genres = input.Genres
 	v := validator.New()
-	if models.ValidateBook(v, book); !v.Valid() {
+	if v.Check(validator.ValidISBN13(isbn), "isbn", "must be a valid ISBN-10 or ISBN-13"); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	err = app.models.Books.Update(book)
-	if err != nil {
-		switch {
-		case errors.Is(err, models.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
-		return
-	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"book": book}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-	}
-}
 
-func (app *application) deleteBookHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.readIDParam(r)
-	if err != nil {
-		app.notFoundResponse(w, r)
-		return
-	}
-	err = app.models.Books.Delete(id)
+	book, err := app.models.Works[models.BookKind.Name].(models.BookStore).GetByISBN(r.Context(), isbn)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrRecordNotFound):
@@ -136,40 +31,11 @@ func (app *application) deleteBookHandler(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-	}
-}
-
-func (app *application) listBooksHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title  string
-		Genres []string
-		models.Filters
-	}
-	v := validator.New()
-	qs := r.URL.Query()
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
-	input.Filters.Page = app.readInt(qs, "page", 1, v)
-	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "year", "author", "-id", "-title", "-year", "-author"}
-
-	if models.ValidateFilters(v, input.Filters); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
-		return
-	}
-
-	books, metadata, err := app.models.Books.GetAll(input.Title, input.Genres, input.Filters)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
+	headers := make(http.Header)
+	headers.Set("ETag", etag(book.Version))
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"books": books, "metadata": metadata}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"book": book}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
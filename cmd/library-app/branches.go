@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"library-app/pkg/jsonpatch"
+	"library-app/pkg/models"
+	"library-app/pkg/validator"
+	"net/http"
+)
+
+// readBranch looks up the branch named in the URL. It sends the error
+// response itself and returns nil if there is no such branch.
+func (app *application) readBranch(w http.ResponseWriter, r *http.Request) *models.Branch {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	branch, err := app.models.Branches.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return branch
+}
+
+func (app *application) listBranchesHandler(w http.ResponseWriter, r *http.Request) {
+	branches, err := app.models.Branches.GetAll(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"branches": branches}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createBranchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code    string `json:"code"`
+		Name    string `json:"name"`
+		Address string `json:"address"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	branch := &models.Branch{Code: input.Code, Name: input.Name, Address: input.Address}
+	v := validator.New()
+	if models.ValidateBranch(v, branch); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Branches.Insert(r.Context(), branch)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateBranchCode):
+			v.AddError("code", "a branch with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/branches/%d", branch.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"branch": branch}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showBranchHandler(w http.ResponseWriter, r *http.Request) {
+	branch := app.readBranch(w, r)
+	if branch == nil {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(branch.Version))
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"branch": branch}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) patchBranchHandler(w http.ResponseWriter, r *http.Request) {
+	branch := app.readBranch(w, r)
+	if branch == nil {
+		return
+	}
+	if !app.ifMatch(r, branch.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+	input := *branch
+	err := app.readPatch(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedPatch):
+			app.unsupportedMediaTypeResponse(w, r)
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.patchFailedResponse(w, r, err)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+	input.ID = branch.ID
+	input.CreatedAt = branch.CreatedAt
+	input.Version = branch.Version
+
+	v := validator.New()
+	if models.ValidateBranch(v, &input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Branches.Update(r.Context(), &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, models.ErrDuplicateBranchCode):
+			v.AddError("code", "a branch with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(input.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"branch": &input}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteBranchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Branches.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrBranchInUse):
+			app.circulationConflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "branch successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"library-app/pkg/jsonpatch"
+	"library-app/pkg/models"
+	"library-app/pkg/validator"
+	"net/http"
+)
+
+// readChapter looks up the chapter named in the URL. It sends the error
+// response itself and returns nil if there is no such chapter.
+func (app *application) readChapter(w http.ResponseWriter, r *http.Request) *models.Chapter {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	chapter, err := app.models.Chapters.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return chapter
+}
+
+// chapterWriteError sends the response for an error from writing a chapter.
+func (app *application) chapterWriteError(w http.ResponseWriter, r *http.Request, v *validator.Validator, err error) {
+	switch {
+	case errors.Is(err, models.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, models.ErrEditConflict):
+		app.editConflictResponse(w, r)
+	case errors.Is(err, models.ErrDuplicateChapter):
+		v.AddError("number", "the series already has a chapter with this number")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, models.ErrUnknownVolume):
+		v.AddError("manga_id", "must reference a volume of the series")
+		app.failedValidationResponse(w, r, v.Errors)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listChaptersHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var filters models.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 100, v)
+
+	filters.Sort = app.readString(qs, "sort", "number")
+	filters.SortSafelist = []string{"number", "release_date", "-number", "-release_date"}
+
+	if models.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Series[models.MangaKind.Name].Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	chapters, metadata, err := app.models.Chapters.GetAllForSeries(r.Context(), id, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"chapters": chapters, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createChapterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Number      float64      `json:"number"`
+		Title       string       `json:"title"`
+		ReleaseDate *models.Date `json:"release_date"`
+		MangaID     *int64       `json:"manga_id"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	chapter := &models.Chapter{SeriesID: id, Number: input.Number, Title: input.Title, ReleaseDate: input.ReleaseDate, MangaID: input.MangaID}
+	v := validator.New()
+	if models.ValidateChapter(v, chapter); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Chapters.Insert(r.Context(), chapter)
+	if err != nil {
+		app.chapterWriteError(w, r, v, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/manga/chapters/%d", chapter.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"chapter": chapter}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showChapterHandler(w http.ResponseWriter, r *http.Request) {
+	chapter := app.readChapter(w, r)
+	if chapter == nil {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(chapter.Version))
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"chapter": chapter}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// patchChapterHandler edits a chapter. A chapter stays in its series.
+func (app *application) patchChapterHandler(w http.ResponseWriter, r *http.Request) {
+	chapter := app.readChapter(w, r)
+	if chapter == nil {
+		return
+	}
+	if !app.ifMatch(r, chapter.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+	input := *chapter
+	err := app.readPatch(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedPatch):
+			app.unsupportedMediaTypeResponse(w, r)
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.patchFailedResponse(w, r, err)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+	input.ID = chapter.ID
+	input.SeriesID = chapter.SeriesID
+	input.CreatedAt = chapter.CreatedAt
+	input.Version = chapter.Version
+
+	v := validator.New()
+	if models.ValidateChapter(v, &input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Chapters.Update(r.Context(), &input)
+	if err != nil {
+		app.chapterWriteError(w, r, v, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(input.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"chapter": &input}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteChapterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Chapters.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "chapter successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listMyReadingHandler lists the series the caller's member is reading, with
+// how many chapters they have left.
+func (app *application) listMyReadingHandler(w http.ResponseWriter, r *http.Request) {
+	member, err := app.ownMember(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	reading := []*models.Reading{}
+	if member != nil {
+		reading, err = app.models.Reading.GetAllForMember(r.Context(), member.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"reading": reading}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateMyReadingHandler records the last chapter the caller's member has
+// read in the series in the URL.
+func (app *application) updateMyReadingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		LastChapter float64 `json:"last_chapter"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if models.ValidateLastChapter(v, input.LastChapter); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	member, err := app.ownMember(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if member == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	reading, err := app.models.Reading.Set(r.Context(), member.ID, id, input.LastChapter)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound), errors.Is(err, models.ErrUnknownMember):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"reading": reading}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMyReadingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	member, err := app.ownMember(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if member == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Reading.Delete(r.Context(), member.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "reading progress successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
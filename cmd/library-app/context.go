@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"library-app/pkg/models"
+	"net/http"
+)
+
+type contextKey string
+
+const (
+	userContextKey   = contextKey("user")
+	apiKeyContextKey = contextKey("apiKey")
+)
+
+func (app *application) contextSetUser(r *http.Request, user *models.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetUser(r *http.Request) *models.User {
+	user, ok := r.Context().Value(userContextKey).(*models.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+	return user
+}
+
+func (app *application) contextSetAPIKey(r *http.Request, key *models.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey returns the API key the request was made with, or nil if
+// it wasn't made with one.
+func (app *application) contextGetAPIKey(r *http.Request) *models.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*models.APIKey)
+	return key
+}
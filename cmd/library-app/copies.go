@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"library-app/pkg/jsonpatch"
+	"library-app/pkg/models"
+	"library-app/pkg/validator"
+	"net/http"
+)
+
+func (app *application) readBarcodeParam(r *http.Request) string {
+	return httprouter.ParamsFromContext(r.Context()).ByName("barcode")
+}
+
+// readCopy looks up the copy named in the URL. It sends the error response
+// itself and returns nil if there is no such copy.
+func (app *application) readCopy(w http.ResponseWriter, r *http.Request) *models.Copy {
+	c, err := app.models.Copies.GetByBarcode(r.Context(), app.readBarcodeParam(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return c
+}
+
+func (app *application) showCopyHandler(w http.ResponseWriter, r *http.Request) {
+	c := app.readCopy(w, r)
+	if c == nil {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(c.Version))
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"copy": c}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) patchCopyHandler(w http.ResponseWriter, r *http.Request) {
+	c := app.readCopy(w, r)
+	if c == nil {
+		return
+	}
+	if !app.ifMatch(r, c.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+	input := *c
+	err := app.readPatch(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedPatch):
+			app.unsupportedMediaTypeResponse(w, r)
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.patchFailedResponse(w, r, err)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+	// A copy stays with the work it was added to, and only moves between
+	// branches through transfers and returns.
+	input.ID = c.ID
+	input.WorkType = c.WorkType
+	input.WorkID = c.WorkID
+	input.CurrentBranchID = c.CurrentBranchID
+	input.CreatedAt = c.CreatedAt
+	input.Version = c.Version
+
+	v := validator.New()
+	// Copies go on and off loan, hold and transit through circulation only.
+	circulating := []string{models.CopyOnLoan, models.CopyOnHold, models.CopyInTransit}
+	v.Check(input.Status == c.Status || (!validator.In(input.Status, circulating...) && !validator.In(c.Status, circulating...)), "status", "must not be changed to or from on_loan, on_hold or in_transit, which loans, holds and transfers manage")
+	if models.ValidateCopy(v, &input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Copies.Update(r.Context(), &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, models.ErrDuplicateBarcode):
+			v.AddError("barcode", "a copy with this barcode already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrUnknownBranch):
+			v.AddError("home_branch_id", "must reference an existing branch")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(input.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"copy": &input}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCopyHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Copies.Delete(r.Context(), app.readBarcodeParam(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrCopyOnLoan), errors.Is(err, models.ErrCopyOnHold), errors.Is(err, models.ErrCopyInUse):
+			app.circulationConflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "copy successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
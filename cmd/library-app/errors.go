@@ -1,15 +1,34 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/lib/pq"
+	"library-app/pkg/models"
 	"net/http"
+	"strconv"
 )
 
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.PrintError(err, map[string]string{
+	properties := map[string]string{
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
-	})
+	}
+	// The user is read straight from the context, as contextGetUser panics
+	// for errors raised before authenticate has run.
+	if key := app.contextGetAPIKey(r); key != nil {
+		properties["api_key_id"] = strconv.FormatInt(key.ID, 10)
+		properties["api_key_name"] = key.Name
+	} else if user, ok := r.Context().Value(userContextKey).(*models.User); ok && !user.IsAnonymous() {
+		if user.ID != 0 {
+			properties["user_id"] = strconv.FormatInt(user.ID, 10)
+		}
+		if user.Subject != "" {
+			properties["oidc_subject"] = user.Subject
+		}
+	}
+	app.logger.PrintError(err, properties)
 }
 
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
@@ -22,6 +41,10 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 }
 
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if queryCancelled(err) {
+		app.queryTimeoutResponse(w, r, err)
+		return
+	}
 	app.logError(r, err)
 	message := "the server encountered a problem and could not process your request"
 	app.errorResponse(w, r, http.StatusInternalServerError, message)
@@ -49,3 +72,84 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 	message := "rate limit exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
+
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has been modified since it was last read, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "PATCH requests must use application/merge-patch+json or application/json-patch+json"
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+func (app *application) patchFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusConflict, err.Error())
+}
+
+// queryCancelled reports whether err comes from a query that was cut short by
+// its context, either as the context error itself or as the "canceling
+// statement" error Postgres returns once lib/pq has cancelled the query.
+func queryCancelled(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "57014" {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+func (app *application) queryTimeoutResponse(w http.ResponseWriter, r *http.Request, err error) {
+	// If the client has gone away there is nobody left to answer.
+	if r.Context().Err() != nil {
+		return
+	}
+	app.logError(r, err)
+	message := "the database took too long to respond, please try again later"
+	app.errorResponse(w, r, http.StatusGatewayTimeout, message)
+}
+
+func (app *application) authorHasWorksResponse(w http.ResponseWriter, r *http.Request, works []models.CreditedWork) {
+	message := envelope{
+		"message": "the author is still credited on works, delete them with strategy=cascade or move them to another author with strategy=reassign&to={author_id}",
+		"works":   works,
+	}
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// circulationConflictResponse refuses a loan, hold, transfer or other change
+// that the state of the copies, members or branches involved doesn't allow,
+// with err saying why.
+func (app *application) circulationConflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusConflict, err.Error())
+}
+
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must be activated to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
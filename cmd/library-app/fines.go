@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"library-app/pkg/models"
+	"library-app/pkg/validator"
+	"net/http"
+)
+
+func (app *application) finePolicy() models.FinePolicy {
+	return models.FinePolicy{
+		Rates: map[string]int64{
+			models.BookKind.Name:  app.config.fines.bookRate,
+			models.MangaKind.Name: app.config.fines.mangaRate,
+		},
+		GraceDays:  app.config.fines.graceDays,
+		MaxCents:   app.config.fines.maxCents,
+		BlockCents: app.config.fines.blockCents,
+	}
+}
+
+// readFineFilters reads the ledger filters and pagination shared by the
+// ledger and a member's own fines.
+func (app *application) readFineFilters(r *http.Request, v *validator.Validator) (models.FineFilter, models.Filters) {
+	var filter models.FineFilter
+	var filters models.Filters
+	qs := r.URL.Query()
+	filter.MemberID = app.readInt64(qs, "member_id", 0, v)
+	filter.Kind = app.readString(qs, "kind", "")
+	filter.CreatedAfter = app.readTime(qs, "created_after", v)
+	filter.CreatedBefore = app.readTime(qs, "created_before", v)
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	filters.Sort = app.readString(qs, "sort", "-created_at")
+	filters.SortSafelist = []string{"created_at", "-created_at"}
+
+	models.ValidateFineFilter(v, filter)
+	models.ValidateFilters(v, filters)
+	return filter, filters
+}
+
+// listFinesHandler lists the ledger with the totals of the matching entries,
+// for reconciling payments.
+func (app *application) listFinesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	filter, filters := app.readFineFilters(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, totals, metadata, err := app.models.Fines.GetAll(r.Context(), filter, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"fines": entries, "totals": totals, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showMemberFinesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	balance, err := app.models.Fines.Balance(r.Context(), id, app.finePolicy())
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"balance": balance}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showMyFinesHandler shows the caller what their member owes, with their
+// ledger.
+func (app *application) showMyFinesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	filter, filters := app.readFineFilters(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	member, err := app.ownMember(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if member == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	filter.MemberID = member.ID
+
+	balance, err := app.models.Fines.Balance(r.Context(), filter.MemberID, app.finePolicy())
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	entries, _, metadata, err := app.models.Fines.GetAll(r.Context(), filter, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"balance": balance, "fines": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createFinePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	app.recordFine(w, r, models.FinePayment)
+}
+
+func (app *application) createFineWaiverHandler(w http.ResponseWriter, r *http.Request) {
+	app.recordFine(w, r, models.FineWaiver)
+}
+
+// recordFine takes a payment or waiver of kind off the balance of the member
+// in the URL.
+func (app *application) recordFine(w http.ResponseWriter, r *http.Request, kind string) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		AmountCents int64  `json:"amount_cents"`
+		Note        string `json:"note"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	entry := &models.FineEntry{MemberID: id, Kind: kind, AmountCents: input.AmountCents, Note: input.Note}
+	v := validator.New()
+	if models.ValidateFineEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Fines.Record(r.Context(), entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrUnknownMember):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrOverpayment):
+			v.AddError("amount_cents", "must not be more than the member owes")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/members/%d/fines", id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"fine": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"library-app/pkg/models"
+)
+
+// formats lists the media types of the catalogue. Their models, routes and
+// mocks and the tables the trash, holds and loans look across all come from
+// this list.
+var formats = []format{
+	workFormat[models.Book, *models.Book]{format: models.BookFormat},
+	workFormat[models.Manga, *models.Manga]{format: models.MangaFormat, seriesWorks: "volumes"},
+}
+
+type format interface {
+	model() models.Format
+	registerRoutes(app *application, router, static *httprouter.Router)
+}
+
+// workFormat serves a models.WorkFormat. seriesWorks names the works of a
+// series in its routes, as in /v1/manga/series/:id/volumes.
+type workFormat[T any, PT models.Record[T]] struct {
+	format      models.WorkFormat[T, PT]
+	seriesWorks string
+}
+
+func (f workFormat[T, PT]) model() models.Format {
+	return f.format
+}
+
+func (f workFormat[T, PT]) registerRoutes(app *application, router, static *httprouter.Router) {
+	kind := f.format.Kind
+	store := models.StoreOf(app.models, kind)
+	registerWorkRoutes[T, PT](app, router, kind, store)
+	if kind.SeriesTable != "" {
+		registerSeriesRoutes[T, PT](app, static, kind, store, app.models.Series[kind.Name], f.seriesWorks)
+	}
+}
+
+func modelFormats() []models.Format {
+	list := make([]models.Format, 0, len(formats))
+	for _, f := range formats {
+		list = append(list, f.model())
+	}
+	return list
+}
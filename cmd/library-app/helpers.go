@@ -1,16 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt" // New import
 	"github.com/julienschmidt/httprouter"
 	"io" // New import
+	"library-app/pkg/jsonpatch"
+	"library-app/pkg/models"
 	"library-app/pkg/validator"
+	"mime"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
@@ -39,10 +45,75 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, models enve
 	return nil
 }
 
+const maxBytes = 1_048_576
+
+var errUnsupportedPatch = errors.New("unsupported patch content type")
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
-	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes)) // Initialize the json.Decoder, and call the DisallowUnknownFields() method on it
-	dec := json.NewDecoder(r.Body)
+	return decodeJSON(r.Body, dst)
+}
+
+// readPatch applies the request body as a JSON Merge Patch or JSON Patch,
+// depending on its Content-Type, to the JSON form of dst and decodes the
+// result back into dst. Fields removed by the patch end up as zero values.
+func (app *application) readPatch(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != jsonpatch.MergePatchType && mediaType != jsonpatch.JSONPatchType {
+		return errUnsupportedPatch
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		}
+		return err
+	}
+	if len(patch) == 0 {
+		return errors.New("body must not be empty")
+	}
+	doc, err := patchDocument(dst)
+	if err != nil {
+		return err
+	}
+	if mediaType == jsonpatch.MergePatchType {
+		doc, err = jsonpatch.MergePatch(doc, patch)
+	} else {
+		doc, err = jsonpatch.Apply(doc, patch)
+	}
+	if err != nil {
+		return err
+	}
+	reflect.ValueOf(dst).Elem().SetZero()
+	return decodeJSON(bytes.NewReader(doc), dst)
+}
+
+// patchDocument returns the JSON form of dst that patches apply to. Alias
+// keys are left out, so a patch changes them only by setting them.
+func patchDocument(dst interface{}) ([]byte, error) {
+	doc, err := json.Marshal(dst)
+	if err != nil {
+		return nil, err
+	}
+	aliased, ok := dst.(models.Aliased)
+	if !ok {
+		return doc, nil
+	}
+	var values map[string]json.RawMessage
+	err = json.Unmarshal(doc, &values)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range aliased.AliasKeys() {
+		delete(values, key)
+	}
+	return json.Marshal(values)
+}
+
+func decodeJSON(body io.Reader, dst interface{}) error {
+	dec := json.NewDecoder(body)
 	dec.DisallowUnknownFields()
 	err := dec.Decode(dst)
 	if err != nil {
@@ -107,3 +178,68 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	}
 	return i
 }
+
+func (app *application) readInt64(qs url.Values, key string, defaultValue int64, v *validator.Validator) int64 {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+	return i
+}
+
+// readTime accepts either a plain YYYY-MM-DD date or an RFC 3339 timestamp.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return time.Time{}
+	}
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t
+		}
+	}
+	v.AddError(key, "must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+	return time.Time{}
+}
+
+// etag returns the strong entity tag for a record at the given version.
+func etag(version int32) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatch reports whether the If-Match request header allows a write against
+// a record at the given version. A missing header always matches; weak tags
+// never do, as If-Match requires strong comparison.
+func (app *application) ifMatch(r *http.Request, version int32) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// background runs fn in its own goroutine, logging rather than crashing the
+// server if it panics.
+func (app *application) background(fn func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.PrintError(fmt.Errorf("%s", err), nil)
+			}
+		}()
+		fn()
+	}()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"library-app/pkg/models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// actsFor reports whether the request may act for the member: either it
+// comes from the user linked to the member, or it holds the permission code.
+// A failed lookup is logged and counts as a refusal.
+func (app *application) actsFor(r *http.Request, memberID int64, code string) bool {
+	member, err := app.ownMember(r)
+	if err != nil {
+		app.logError(r, err)
+		return false
+	}
+	if member != nil && member.ID == memberID {
+		return true
+	}
+	permissions, err := app.permissions(r)
+	if err != nil {
+		app.logError(r, err)
+		return false
+	}
+	return permissions.Include(code)
+}
+
+// readHold looks up the hold named in the URL, on behalf of its member or of
+// a request holding the permission code. It sends the error response itself
+// and returns nil otherwise.
+func (app *application) readHold(w http.ResponseWriter, r *http.Request, code string) *models.Hold {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	hold, err := app.models.Holds.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	if !app.actsFor(r, hold.MemberID, code) {
+		app.notPermittedResponse(w, r)
+		return nil
+	}
+	return hold
+}
+
+func (app *application) showHoldHandler(w http.ResponseWriter, r *http.Request) {
+	hold := app.readHold(w, r, "holds:read")
+	if hold == nil {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"hold": hold}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) cancelHoldHandler(w http.ResponseWriter, r *http.Request) {
+	hold := app.readHold(w, r, "holds:write")
+	if hold == nil {
+		return
+	}
+	hold, err := app.models.Holds.Cancel(r.Context(), hold.ID, app.config.holds.pickupDays)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrHoldClosed):
+			app.circulationConflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"hold": hold}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listMyHoldsHandler lists the open holds of the caller's member, if they
+// have one.
+func (app *application) listMyHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	member, err := app.ownMember(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	holds := []*models.Hold{}
+	if member != nil {
+		holds, err = app.models.Holds.GetAllForMember(r.Context(), member.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"holds": holds}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// processHolds skips holds whose pickup window has closed and sets copies on
+// the shelf aside for waiting holds, every process interval. It runs for the
+// lifetime of the process.
+func (app *application) processHolds() {
+	for {
+		app.processHoldsOnce()
+		time.Sleep(app.config.holds.processInterval)
+	}
+}
+
+func (app *application) processHoldsOnce() {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.PrintError(fmt.Errorf("%s", err), map[string]string{"task": "process holds"})
+		}
+	}()
+	expired, err := app.models.Holds.Process(context.Background(), app.config.holds.pickupDays)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"task": "process holds"})
+		return
+	}
+	if expired > 0 {
+		app.logger.PrintInfo("expired holds", map[string]string{
+			"holds": strconv.Itoa(expired),
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"library-app/pkg/models"
+	"library-app/pkg/validator"
+	"net/http"
+)
+
+func (app *application) loanPolicy() models.LoanPolicy {
+	return models.LoanPolicy{
+		Days: map[string]int{
+			models.BookKind.Name:  app.config.loans.bookDays,
+			models.MangaKind.Name: app.config.loans.mangaDays,
+		},
+		MaxActive:   app.config.loans.maxActive,
+		MaxRenewals: app.config.loans.maxRenewals,
+		PickupDays:  app.config.holds.pickupDays,
+		Fines:       app.finePolicy(),
+	}
+}
+
+func (app *application) createLoanHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Barcode  string `json:"barcode"`
+		MemberID int64  `json:"member_id"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	models.ValidateBarcode(v, input.Barcode)
+	if v.Check(input.MemberID > 0, "member_id", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	loan, err := app.models.Loans.Checkout(r.Context(), input.Barcode, input.MemberID, app.loanPolicy())
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("barcode", "must belong to a copy")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrUnknownMember):
+			v.AddError("member_id", "must reference an existing member")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrCopyUnavailable), errors.Is(err, models.ErrLoanLimit), errors.Is(err, models.ErrFinesOwed), errors.Is(err, models.ErrMemberBlocked), errors.Is(err, models.ErrMembershipExpired):
+			app.circulationConflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/loans/%d", loan.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"loan": loan}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showLoanHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	loan, err := app.models.Loans.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"loan": loan}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listLoansHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		models.LoanFilter
+		models.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.MemberID = app.readInt64(qs, "member_id", 0, v)
+	input.Status = app.readString(qs, "status", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-loaned_at")
+	input.Filters.SortSafelist = []string{"loaned_at", "due_at", "-loaned_at", "-due_at"}
+
+	models.ValidateLoanFilter(v, input.LoanFilter)
+	if models.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	loans, metadata, err := app.models.Loans.GetAll(r.Context(), input.LoanFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"loans": loans, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// returnLoanHandler checks a loan in, at the branch given by the branch_id
+// query parameter if the copy came back somewhere else.
+func (app *application) returnLoanHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	v := validator.New()
+	branchID := app.readInt64(r.URL.Query(), "branch_id", 0, v)
+	if v.Check(branchID >= 0, "branch_id", "must be a positive integer"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	loan, err := app.models.Loans.Return(r.Context(), id, branchID, app.loanPolicy())
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrUnknownBranch):
+			v.AddError("branch_id", "must reference an existing branch")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrLoanReturned):
+			app.circulationConflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"loan": loan}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) renewLoanHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	loan, err := app.models.Loans.Renew(r.Context(), id, app.loanPolicy())
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrLoanReturned), errors.Is(err, models.ErrRenewalLimit), errors.Is(err, models.ErrHoldsWaiting), errors.Is(err, models.ErrFinesOwed), errors.Is(err, models.ErrMemberBlocked), errors.Is(err, models.ErrMembershipExpired):
+			app.circulationConflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"loan": loan}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"library-app/pkg/jsonlog"
+	"library-app/pkg/mailer"
 	"library-app/pkg/models"
+	"library-app/pkg/oidc"
 	"log"
 	"net/http"
 	"os"
@@ -30,18 +32,66 @@ type config struct {
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
+		timeouts     struct {
+			read   time.Duration
+			write  time.Duration
+			search time.Duration
+		}
 	}
 	limiter struct {
 		rps     float64
 		burst   int
 		enabled bool
 	}
+	loans struct {
+		bookDays    int
+		mangaDays   int
+		maxActive   int
+		maxRenewals int
+	}
+	fines struct {
+		bookRate   int64
+		mangaRate  int64
+		graceDays  int
+		maxCents   int64
+		blockCents int64
+	}
+	holds struct {
+		pickupDays      int
+		processInterval time.Duration
+	}
+	members struct {
+		months int
+	}
+	jwt struct {
+		jwks       string
+		refresh    time.Duration
+		issuer     string
+		audience   string
+		rolesClaim string
+		leeway     time.Duration
+	}
+	trash struct {
+		retention     int
+		purgeInterval time.Duration
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
 }
 
 type application struct {
 	config config
 	logger *jsonlog.Logger
 	models models.Models
+	mailer mailer.Mailer
+	// verifier checks JWT bearer tokens. It is nil when no JWKS is
+	// configured, and JWTs are then refused.
+	verifier *oidc.Verifier
 }
 
 func main() {
@@ -58,9 +108,45 @@ func main() {
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
 
+	flag.DurationVar(&cfg.db.timeouts.read, "db-read-timeout", 3*time.Second, "PostgreSQL timeout for single record lookups")
+	flag.DurationVar(&cfg.db.timeouts.write, "db-write-timeout", 5*time.Second, "PostgreSQL timeout for inserts, updates and deletes")
+	flag.DurationVar(&cfg.db.timeouts.search, "db-search-timeout", 3*time.Second, "PostgreSQL timeout for list and search queries")
+
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+
+	flag.IntVar(&cfg.loans.bookDays, "loan-days-books", 21, "Loan period of books in days")
+	flag.IntVar(&cfg.loans.mangaDays, "loan-days-manga", 14, "Loan period of manga in days")
+	flag.IntVar(&cfg.loans.maxActive, "loan-max-active", 5, "Maximum number of loans a member can have at once")
+	flag.IntVar(&cfg.loans.maxRenewals, "loan-max-renewals", 2, "Maximum number of times a loan can be renewed")
+
+	flag.Int64Var(&cfg.fines.bookRate, "fine-rate-books", 25, "Fine in cents per day a book is overdue")
+	flag.Int64Var(&cfg.fines.mangaRate, "fine-rate-manga", 25, "Fine in cents per day a manga is overdue")
+	flag.IntVar(&cfg.fines.graceDays, "fine-grace-days", 1, "Days a loan can be overdue before it is fined")
+	flag.Int64Var(&cfg.fines.maxCents, "fine-max", 2000, "Maximum fine in cents for one loan (0 for no cap)")
+	flag.Int64Var(&cfg.fines.blockCents, "fine-block", 1000, "Fines in cents a member can owe and still borrow (0 never blocks)")
+
+	flag.IntVar(&cfg.holds.pickupDays, "hold-pickup-days", 7, "Days a copy stays set aside for a hold before it goes to the next member")
+	flag.DurationVar(&cfg.holds.processInterval, "hold-process-interval", 10*time.Minute, "How often expired holds are skipped and copies on the shelf set aside for holds")
+
+	flag.IntVar(&cfg.members.months, "membership-months", 12, "Months a new or renewed membership lasts")
+
+	flag.StringVar(&cfg.jwt.jwks, "jwt-jwks", "", "JWKS file or URL to verify JWT bearer tokens with (JWTs are refused when empty)")
+	flag.DurationVar(&cfg.jwt.refresh, "jwt-jwks-refresh", time.Hour, "How long the JWKS is cached before it is loaded again")
+	flag.StringVar(&cfg.jwt.issuer, "jwt-issuer", "", "Required iss claim of JWTs")
+	flag.StringVar(&cfg.jwt.audience, "jwt-audience", "", "Required aud claim of JWTs")
+	flag.StringVar(&cfg.jwt.rolesClaim, "jwt-roles-claim", "roles", "Claim of JWTs holding the user's roles (may be a dotted path)")
+	flag.DurationVar(&cfg.jwt.leeway, "jwt-leeway", time.Minute, "Clock skew allowed when checking exp and nbf of JWTs")
+
+	flag.IntVar(&cfg.trash.retention, "trash-retention-days", 30, "Days deleted records stay in the trash before they are purged (0 keeps them forever)")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often expired records are purged from the trash")
+
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "", "SMTP host (emails are logged instead of sent when empty)")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Library <no-reply@library-app.local>", "SMTP sender")
 	flag.Parse()
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
@@ -76,8 +162,17 @@ func main() {
 	app := &application{
 		config: cfg,
 		logger: logger,
-		models: models.NewModels(db),
+		models: models.NewModels(db, models.Timeouts{
+			Read:   cfg.db.timeouts.read,
+			Write:  cfg.db.timeouts.write,
+			Search: cfg.db.timeouts.search,
+		}, modelFormats()...),
+		mailer:   newMailer(cfg, logger),
+		verifier: newVerifier(cfg),
 	}
+	go app.purgeTrash()
+	go app.processHolds()
+
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.port),
 		Handler:      app.routes(),
@@ -94,6 +189,32 @@ func main() {
 	logger.PrintFatal(err, nil)
 }
 
+func newVerifier(cfg config) *oidc.Verifier {
+	if cfg.jwt.jwks == "" {
+		return nil
+	}
+	return &oidc.Verifier{
+		Keys:       oidc.NewKeySet(cfg.jwt.jwks, cfg.jwt.refresh),
+		Issuer:     cfg.jwt.issuer,
+		Audience:   cfg.jwt.audience,
+		RolesClaim: cfg.jwt.rolesClaim,
+		Leeway:     cfg.jwt.leeway,
+	}
+}
+
+func newMailer(cfg config, logger *jsonlog.Logger) mailer.Mailer {
+	if cfg.smtp.host == "" {
+		return mailer.Log{Logger: logger}
+	}
+	return mailer.SMTP{
+		Host:     cfg.smtp.host,
+		Port:     cfg.smtp.port,
+		Username: cfg.smtp.username,
+		Password: cfg.smtp.password,
+		Sender:   cfg.smtp.sender,
+	}
+}
+
 func openDB(cfg config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg.db.dsn)
 	if err != nil {
@@ -1,171 +0,0 @@
-package main
-
-import (
-	"errors"
-	"fmt"
-	"library-app/pkg/models"
-	"library-app/pkg/validator"
-	"net/http"
-)
-
-func (app *application) createMangaHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title    string   `json:"title"`
-		Year     int32    `json:"year"`
-		AuthorId int64    `json:"author_id"`
-		Genres   []string `json:"genres"`
-	}
-	err := app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
-	// Copy the values from the input struct to a new Movie struct.
-	manga := &models.Manga{
-		Title:    input.Title,
-		Year:     input.Year,
-		AuthorId: input.AuthorId,
-		Genres:   input.Genres,
-	}
-	v := validator.New()
-	if models.ValidateManga(v, manga); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
-		return
-	}
-	err = app.models.Mangas.Insert(manga)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/manga/%d", manga.ID))
-
-	err = app.writeJSON(w, http.StatusCreated, envelope{"manga": manga}, headers)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-	}
-}
-
-func (app *application) showMangaHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.readIDParam(r)
-	if err != nil {
-		app.notFoundResponse(w, r)
-		return
-	}
-	manga, err := app.models.Mangas.Get(id)
-	if err != nil {
-		switch {
-		case errors.Is(err, models.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
-		return
-	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"manga": manga}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-	}
-}
-
-func (app *application) updateMangaHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.readIDParam(r)
-	if err != nil {
-		app.notFoundResponse(w, r)
-		return
-	}
-	manga, err := app.models.Mangas.Get(id)
-	if err != nil {
-		switch {
-		case errors.Is(err, models.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
-		return
-	}
-	var input struct {
-		Title    string   `json:"title"`
-		Year     int32    `json:"year"`
-		AuthorId int64    `json:"author_id"`
-		Genres   []string `json:"genres"`
-	}
-	err = app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
-	manga.Title = input.Title
-	manga.Year = input.Year
-	manga.AuthorId = input.AuthorId
-	manga.Genres = input.Genres
-	v := validator.New()
-	if models.ValidateManga(v, manga); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
-		return
-	}
-	err = app.models.Mangas.Update(manga)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"manga": manga}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-	}
-}
-
-func (app *application) deleteMangaHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.readIDParam(r)
-	if err != nil {
-		app.notFoundResponse(w, r)
-		return
-	}
-	err = app.models.Mangas.Delete(id)
-	if err != nil {
-		switch {
-		case errors.Is(err, models.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
-		return
-	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-	}
-}
-
-func (app *application) listMangasHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title  string
-		Genres []string
-		models.Filters
-	}
-	v := validator.New()
-	qs := r.URL.Query()
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
-	input.Filters.Page = app.readInt(qs, "page", 1, v)
-	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
-
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "year", "author", "-id", "-title", "-year", "-author"}
-	if models.ValidateFilters(v, input.Filters); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
-		return
-	}
-
-	mangas, metadata, err := app.models.Mangas.GetAll(input.Title, input.Genres, input.Filters)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	err = app.writeJSON(w, http.StatusOK, envelope{"manga": mangas, "metadata": metadata}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-	}
-}
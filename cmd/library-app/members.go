@@ -0,0 +1,339 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"library-app/pkg/jsonpatch"
+	"library-app/pkg/models"
+	"library-app/pkg/validator"
+	"net/http"
+	"time"
+)
+
+// ownMember looks up the member linked to the signed-in user. It returns nil
+// for API keys, anonymous requests and users with no member.
+func (app *application) ownMember(r *http.Request) (*models.Member, error) {
+	user := app.contextGetUser(r)
+	if app.contextGetAPIKey(r) != nil || user.IsAnonymous() {
+		return nil, nil
+	}
+	member, err := app.models.Members.GetForUser(r.Context(), user.ID)
+	if errors.Is(err, models.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return member, err
+}
+
+// readMember looks up the member named in the URL. It sends the error
+// response itself and returns nil if there is no such member.
+func (app *application) readMember(w http.ResponseWriter, r *http.Request) *models.Member {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	member, err := app.models.Members.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return member
+}
+
+// addMemberErrors turns the errors of a member write that name a field into
+// validation errors. It reports whether it did.
+func addMemberErrors(v *validator.Validator, err error) bool {
+	switch {
+	case errors.Is(err, models.ErrDuplicateCardNumber):
+		v.AddError("card_number", "a member with this card number already exists")
+	case errors.Is(err, models.ErrDuplicateMemberUser):
+		v.AddError("user_id", "is already linked to another member")
+	case errors.Is(err, models.ErrRecordNotFound):
+		v.AddError("user_id", "must reference an existing user")
+	default:
+		return false
+	}
+	return true
+}
+
+func (app *application) listMembersHandler(w http.ResponseWriter, r *http.Request) {
+	var filter models.MemberFilter
+	var filters models.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+	filter.CardNumber = app.readString(qs, "card_number", "")
+	filter.Name = app.readString(qs, "name", "")
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	filters.Sort = app.readString(qs, "sort", "name")
+	filters.SortSafelist = []string{"name", "card_number", "expires_on", "-name", "-card_number", "-expires_on"}
+
+	if models.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	members, metadata, err := app.models.Members.GetAll(r.Context(), filter, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"members": members, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createMemberHandler issues a library card. The membership runs for the
+// configured number of months unless expires_on is given.
+func (app *application) createMemberHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		CardNumber     string       `json:"card_number"`
+		Name           string       `json:"name"`
+		MembershipType string       `json:"membership_type"`
+		ExpiresOn      *models.Date `json:"expires_on"`
+		Email          string       `json:"email"`
+		Phone          string       `json:"phone"`
+		Address        string       `json:"address"`
+		UserID         *int64       `json:"user_id"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	member := &models.Member{
+		CardNumber:     input.CardNumber,
+		Name:           input.Name,
+		MembershipType: input.MembershipType,
+		ExpiresOn:      models.NewDate(time.Now().AddDate(0, app.config.members.months, 0)),
+		Email:          input.Email,
+		Phone:          input.Phone,
+		Address:        input.Address,
+		UserID:         input.UserID,
+	}
+	if input.ExpiresOn != nil {
+		member.ExpiresOn = *input.ExpiresOn
+	}
+	v := validator.New()
+	if models.ValidateMember(v, member); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Members.Insert(r.Context(), member)
+	if err != nil {
+		if addMemberErrors(v, err) {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/members/%d", member.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"member": member}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showMemberHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.readMember(w, r)
+	if member == nil {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(member.Version))
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"member": member}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// patchMemberHandler edits a member. Blocks are left to the block endpoints,
+// so blocked and blocked_reason are not patched.
+func (app *application) patchMemberHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.readMember(w, r)
+	if member == nil {
+		return
+	}
+	if !app.ifMatch(r, member.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+	input := *member
+	err := app.readPatch(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedPatch):
+			app.unsupportedMediaTypeResponse(w, r)
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.patchFailedResponse(w, r, err)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+	input.ID = member.ID
+	input.Blocked = member.Blocked
+	input.BlockedReason = member.BlockedReason
+	input.CreatedAt = member.CreatedAt
+	input.Version = member.Version
+
+	app.updateMember(w, r, &input)
+}
+
+// blockMemberHandler stops a member from borrowing, renewing or placing
+// holds until they are unblocked.
+func (app *application) blockMemberHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.readMember(w, r)
+	if member == nil {
+		return
+	}
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if v.Check(input.Reason != "", "reason", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	member.Blocked = true
+	member.BlockedReason = input.Reason
+
+	app.updateMember(w, r, member)
+}
+
+func (app *application) unblockMemberHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.readMember(w, r)
+	if member == nil {
+		return
+	}
+	member.Blocked = false
+	member.BlockedReason = ""
+
+	app.updateMember(w, r, member)
+}
+
+// updateMember validates and writes back a member read earlier in the
+// request, and sends it.
+func (app *application) updateMember(w http.ResponseWriter, r *http.Request, member *models.Member) {
+	v := validator.New()
+	if models.ValidateMember(v, member); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err := app.models.Members.Update(r.Context(), member)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case addMemberErrors(v, err):
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(member.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"member": member}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// renewMemberHandler extends a membership by the configured number of
+// months.
+func (app *application) renewMemberHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	member, err := app.models.Members.Renew(r.Context(), id, app.config.members.months)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(member.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"member": member}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showMemberStandingHandler says whether a member may borrow and, if not,
+// why.
+func (app *application) showMemberStandingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	standing, err := app.models.Members.Standing(r.Context(), id, app.finePolicy())
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"standing": standing}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMemberHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Members.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrMemberInUse):
+			app.circulationConflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "member successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"golang.org/x/time/rate"
+	"library-app/pkg/models"
+	"library-app/pkg/oidc"
+	"library-app/pkg/validator"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
@@ -66,3 +72,199 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// recordChanges tags the request context with who is making the request and
+// the reason they gave in the X-Change-Reason header, for the revision
+// history. Anonymous requests are recorded against the client address.
+func (app *application) recordChanges(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		change := models.Change{Reason: r.Header.Get("X-Change-Reason")}
+		v := validator.New()
+		if v.Check(len(change.Reason) <= 500, "X-Change-Reason", "must not be more than 500 bytes long"); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		if key := app.contextGetAPIKey(r); key != nil {
+			change.Actor = "api key " + key.Name
+		} else if user := app.contextGetUser(r); !user.IsAnonymous() {
+			change.Actor = user.Email
+			if change.Actor == "" {
+				change.Actor = "oidc:" + user.Subject
+			}
+		} else {
+			change.Actor, _, _ = net.SplitHostPort(r.RemoteAddr)
+		}
+		next.ServeHTTP(w, r.WithContext(models.ContextWithChange(r.Context(), change)))
+	})
+}
+
+// authenticate puts the user owning the bearer token in the Authorization
+// header into the request context, or the anonymous user if there is none.
+// API keys are bearer tokens too: for those the key goes into the context
+// and the user stays anonymous. JWTs are verified with app.verifier and
+// resolved with oidcUser.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, models.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+		token := headerParts[1]
+
+		if models.IsAPIKey(token) {
+			key, err := app.models.APIKeys.GetForKey(r.Context(), token)
+			if err != nil {
+				switch {
+				case errors.Is(err, models.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			r = app.contextSetUser(r, models.AnonymousUser)
+			r = app.contextSetAPIKey(r, key)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if oidc.LooksLikeJWT(token) {
+			if app.verifier == nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+			claims, err := app.verifier.Verify(r.Context(), token)
+			if err != nil {
+				switch {
+				case errors.Is(err, oidc.ErrInvalidToken):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			user, err := app.oidcUser(r.Context(), claims)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			r = app.contextSetUser(r, user)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		v := validator.New()
+		if models.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		user, err := app.models.Users.GetForToken(r.Context(), models.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRecordNotFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		r = app.contextSetUser(r, user)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// oidcUser returns the user a verified JWT stands for: the user linked to its
+// subject or, failing that, the user with its email if the identity provider
+// verified it, who is then linked to the subject. Other subjects get a user
+// that isn't stored, so they only hold the roles the token grants them.
+func (app *application) oidcUser(ctx context.Context, claims *oidc.Claims) (*models.User, error) {
+	user, err := app.models.Users.GetBySubject(ctx, claims.Subject)
+	if errors.Is(err, models.ErrRecordNotFound) && claims.Email != "" && claims.EmailVerified {
+		user, err = app.models.Users.GetByEmail(ctx, claims.Email)
+		if err == nil {
+			err = app.models.Users.LinkSubject(ctx, user, claims.Subject)
+		}
+	}
+	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err != nil || user == nil {
+		user = &models.User{
+			Name:      claims.Name,
+			Email:     claims.Email,
+			Activated: true,
+			Subject:   claims.Subject,
+		}
+	}
+	user.ExternalRoles = claims.Roles
+	return user, nil
+}
+
+// requireAuthenticatedUser and requireActivatedUser let requests made with an
+// API key through, as keys are only ever issued by admins.
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetAPIKey(r) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user := app.contextGetUser(r)
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		if !user.Activated && app.contextGetAPIKey(r) == nil {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+	return app.requireAuthenticatedUser(fn)
+}
+
+// permissions returns what the request may do: the scopes of its API key or
+// the permissions of its user.
+func (app *application) permissions(r *http.Request) (models.Permissions, error) {
+	if key := app.contextGetAPIKey(r); key != nil {
+		return key.Scopes, nil
+	}
+	user := app.contextGetUser(r)
+	return app.models.Permissions.GetAllForUser(r.Context(), user.ID, user.ExternalRoles...)
+}
+
+// requirePermission only lets activated users holding the permission code,
+// or API keys with it among their scopes, through to next.
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		permissions, err := app.permissions(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return app.requireActivatedUser(fn)
+}
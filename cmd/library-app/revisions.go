@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"library-app/pkg/models"
+	"library-app/pkg/validator"
+	"net/http"
+	"strconv"
+)
+
+func (app *application) readRevisionParam(r *http.Request) (int32, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	revision, err := strconv.ParseInt(params.ByName("rev"), 10, 32)
+	if err != nil || revision < 1 {
+		return 0, errors.New("invalid rev parameter")
+	}
+	return int32(revision), nil
+}
+
+// listRevisions serves the revision history of a record of recordType. get
+// looks the record up so that unknown records are reported as not found.
+func (app *application) listRevisions(w http.ResponseWriter, r *http.Request, recordType string, get func(ctx context.Context, id int64) error) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input models.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "-revision")
+	input.SortSafelist = []string{"revision", "-revision"}
+
+	if models.ValidateFilters(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revisions, metadata, err := app.models.Revisions.GetAll(r.Context(), recordType, id, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revisions": revisions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readRevert looks up the revision named in the URL of a revert request for
+// the record id of recordType. It sends the error response itself and returns
+// nil if the revision is missing or can't be reverted.
+func (app *application) readRevert(w http.ResponseWriter, r *http.Request, recordType string, id int64) *models.Revision {
+	number, err := app.readRevisionParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	revision, err := app.models.Revisions.Get(r.Context(), recordType, id, number)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	if revision.Action != models.ActionUpdate {
+		v := validator.New()
+		v.AddError("rev", "must be an update to be reverted")
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil
+	}
+	return revision
+}
+
+// revertContext returns the context to save a revert with. The revert is
+// recorded with the reason the client gave or, failing that, one naming the
+// reverted revision.
+func revertContext(r *http.Request, revision *models.Revision) context.Context {
+	change := models.ChangeFromContext(r.Context())
+	if change.Reason == "" {
+		change.Reason = fmt.Sprintf("revert revision %d", revision.Revision)
+	}
+	return models.ContextWithChange(r.Context(), change)
+}
+
+// revertFields sets the fields changed by revision on dst back to the values
+// they had before it.
+func revertFields(dst interface{}, revision *models.Revision) error {
+	old := make(map[string]json.RawMessage)
+	for _, change := range revision.Changes {
+		old[change.Field] = change.Old
+	}
+	js, err := json.Marshal(old)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(js, dst)
+}
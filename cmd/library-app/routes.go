@@ -5,7 +5,24 @@ import (
 	"net/http"
 )
 
+// layeredRouter hands a request to the first router with a route for it, or
+// to the last one otherwise. httprouter won't register a static path segment
+// where another route has a wildcard, such as /v1/users/activated next to
+// /v1/users/:id/roles, so those routes go on a router in front of the main one.
+type layeredRouter []*httprouter.Router
+
+func (rs layeredRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, router := range rs[:len(rs)-1] {
+		if handle, _, _ := router.Lookup(r.Method, r.URL.Path); handle != nil {
+			router.ServeHTTP(w, r)
+			return
+		}
+	}
+	rs[len(rs)-1].ServeHTTP(w, r)
+}
+
 func (app *application) routes() http.Handler {
+	static := httprouter.New()
 	router := httprouter.New()
 
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
@@ -13,25 +30,85 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 
-	router.HandlerFunc(http.MethodGet, "/v1/books", app.listBooksHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/books", app.createBookHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/books/:id", app.showBookHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/books/:id", app.updateBookHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/books/:id", app.deleteBookHandler)
-
-	router.HandlerFunc(http.MethodGet, "/v1/manga", app.listMangasHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/manga", app.createMangaHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/manga/:id", app.showMangaHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/manga/:id", app.updateMangaHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/manga/:id", app.deleteMangaHandler)
-
-	router.HandlerFunc(http.MethodGet, "/v1/authors", app.listAuthorsHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/authors", app.createAuthorHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/authors/:id", app.showAuthorHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/authors/:id", app.updateAuthorHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/authors/:id", app.deleteAuthorHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/authors/:id/books", app.listBooksByAuthorHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/authors/:id/manga", app.listMangaByAuthorHandler)
-
-	return app.recoverPanic(app.rateLimit(router))
+	for _, f := range formats {
+		f.registerRoutes(app, router, static)
+	}
+	static.HandlerFunc(http.MethodGet, "/v1/books/isbn/:isbn", app.requirePermission("books:read", app.showBookByISBNHandler))
+	static.HandlerFunc(http.MethodGet, "/v1/manga/series/:id/volumes/next", app.requirePermission("manga:read", app.showNextVolumesHandler))
+	static.HandlerFunc(http.MethodGet, "/v1/manga/series/:id/chapters", app.requirePermission("manga:read", app.listChaptersHandler))
+	static.HandlerFunc(http.MethodPost, "/v1/manga/series/:id/chapters", app.requirePermission("manga:write", app.createChapterHandler))
+	static.HandlerFunc(http.MethodGet, "/v1/manga/chapters/:id", app.requirePermission("manga:read", app.showChapterHandler))
+	static.HandlerFunc(http.MethodPatch, "/v1/manga/chapters/:id", app.requirePermission("manga:write", app.patchChapterHandler))
+	static.HandlerFunc(http.MethodDelete, "/v1/manga/chapters/:id", app.requirePermission("manga:write", app.deleteChapterHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/authors", app.requirePermission("authors:read", app.listAuthorsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/authors", app.requirePermission("authors:write", app.createAuthorHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/authors/:id", app.requirePermission("authors:read", app.showAuthorHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/authors/:id", app.requirePermission("authors:write", app.updateAuthorHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/authors/:id", app.requirePermission("authors:write", app.patchAuthorHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/authors/:id", app.requirePermission("authors:write", app.deleteAuthorHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/authors/:id/restore", app.requirePermission("authors:write", app.restoreAuthorHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/authors/:id/revisions", app.requirePermission("authors:read", app.listAuthorRevisionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/authors/:id/revisions/:rev/revert", app.requirePermission("authors:write", app.revertAuthorHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/branches", app.requirePermission("copies:read", app.listBranchesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/branches", app.requirePermission("branches:write", app.createBranchHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/branches/:id", app.requirePermission("copies:read", app.showBranchHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/branches/:id", app.requirePermission("branches:write", app.patchBranchHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/branches/:id", app.requirePermission("branches:write", app.deleteBranchHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/copies/:barcode", app.requirePermission("copies:read", app.showCopyHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/copies/:barcode", app.requirePermission("copies:write", app.patchCopyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/copies/:barcode", app.requirePermission("copies:write", app.deleteCopyHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/transfers", app.requirePermission("copies:read", app.listTransfersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/transfers", app.requirePermission("copies:write", app.createTransferHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/transfers/:id", app.requirePermission("copies:read", app.showTransferHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/transfers/:id/ship", app.requirePermission("copies:write", app.shipTransferHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/transfers/:id/receive", app.requirePermission("copies:write", app.receiveTransferHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/transfers/:id", app.requirePermission("copies:write", app.cancelTransferHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/loans", app.requirePermission("loans:read", app.listLoansHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/loans", app.requirePermission("loans:write", app.createLoanHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/loans/:id", app.requirePermission("loans:read", app.showLoanHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/loans/:id/return", app.requirePermission("loans:write", app.returnLoanHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/loans/:id/renew", app.requirePermission("loans:write", app.renewLoanHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/holds/:id", app.requireActivatedUser(app.showHoldHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/holds/:id", app.requireActivatedUser(app.cancelHoldHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/me/holds", app.requireActivatedUser(app.listMyHoldsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/me/reading", app.requireActivatedUser(app.listMyReadingHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/me/reading/:id", app.requireActivatedUser(app.updateMyReadingHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/me/reading/:id", app.requireActivatedUser(app.deleteMyReadingHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/members", app.requirePermission("members:read", app.listMembersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/members", app.requirePermission("members:write", app.createMemberHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/members/:id", app.requirePermission("members:read", app.showMemberHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/members/:id", app.requirePermission("members:write", app.patchMemberHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/members/:id", app.requirePermission("members:write", app.deleteMemberHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/members/:id/block", app.requirePermission("members:write", app.blockMemberHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/members/:id/block", app.requirePermission("members:write", app.unblockMemberHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/members/:id/renew", app.requirePermission("members:write", app.renewMemberHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/members/:id/standing", app.requirePermission("members:read", app.showMemberStandingHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/fines", app.requirePermission("fines:read", app.listFinesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/members/:id/fines", app.requirePermission("fines:read", app.showMemberFinesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/members/:id/fines/payments", app.requirePermission("fines:write", app.createFinePaymentHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/members/:id/fines/waivers", app.requirePermission("fines:write", app.createFineWaiverHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/me/fines", app.requireActivatedUser(app.showMyFinesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/trash", app.requirePermission("trash:read", app.listTrashHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	static.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/:id/roles", app.requirePermission("admin", app.updateUserRolesHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/api-keys", app.requirePermission("admin", app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/api-keys", app.requirePermission("admin", app.createAPIKeyHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/api-keys/:id/rotate", app.requirePermission("admin", app.rotateAPIKeyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/api-keys/:id", app.requirePermission("admin", app.revokeAPIKeyHandler))
+
+	return app.recoverPanic(app.authenticate(app.rateLimit(app.recordChanges(layeredRouter{static, router}))))
 }
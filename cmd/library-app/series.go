@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"library-app/pkg/jsonpatch"
+	"library-app/pkg/models"
+	"library-app/pkg/validator"
+	"net/http"
+)
+
+// registerSeriesRoutes adds the routes for the series of a media type under
+// /v1/{plural}/series. A series is shown with its works in series order,
+// which are also listed on their own under /v1/{plural}/series/:id/{works}
+// unless works is empty. The routes go on the static router, as
+// /v1/{plural}/:id takes the segment on the main one, and need the same
+// permissions as the works.
+func registerSeriesRoutes[T any, PT models.Record[T]](app *application, static *httprouter.Router, kind models.Kind[T], store models.WorkStore[T], series models.SeriesStore, works string) {
+	h := workHandlers[T, PT]{app: app, kind: kind, store: store, series: series}
+
+	collection := "/v1/" + kind.Plural + "/series"
+	read, write := kind.Plural+":read", kind.Plural+":write"
+	static.HandlerFunc(http.MethodGet, collection, app.requirePermission(read, h.listSeries))
+	static.HandlerFunc(http.MethodPost, collection, app.requirePermission(write, h.createSeries))
+	static.HandlerFunc(http.MethodGet, collection+"/:id", app.requirePermission(read, h.showSeries))
+	static.HandlerFunc(http.MethodPatch, collection+"/:id", app.requirePermission(write, h.patchSeries))
+	static.HandlerFunc(http.MethodDelete, collection+"/:id", app.requirePermission(write, h.deleteSeries))
+	if works != "" {
+		static.HandlerFunc(http.MethodGet, collection+"/:id/"+works, app.requirePermission(read, h.listSeriesWorks))
+	}
+}
+
+// readSeries looks up the series named in the URL. It sends the error
+// response itself and returns nil if there is no such series.
+func (h workHandlers[T, PT]) readSeries(w http.ResponseWriter, r *http.Request) *models.Series {
+	app := h.app
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	series, err := h.series.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return series
+}
+
+func (h workHandlers[T, PT]) listSeries(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	var filter models.SeriesFilter
+	var filters models.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+	filter.Title = app.readString(qs, "title", "")
+	filter.Status = app.readString(qs, "status", "")
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	filters.Sort = app.readString(qs, "sort", "title")
+	filters.SortSafelist = []string{"id", "title", "-id", "-title"}
+
+	models.ValidateSeriesFilter(v, filter)
+	if models.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	list, metadata, err := h.series.GetAll(r.Context(), filter, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"series": list, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h workHandlers[T, PT]) createSeries(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	var input struct {
+		Title  string `json:"title"`
+		Status string `json:"status"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	series := &models.Series{Title: input.Title, Status: input.Status}
+	if series.Status == "" {
+		series.Status = "ongoing"
+	}
+	v := validator.New()
+	if models.ValidateSeries(v, series); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = h.series.Insert(r.Context(), series)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/%s/series/%d", h.kind.Plural, series.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"series": series}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showSeries shows a series with a page of its works, in series order unless
+// another sort is asked for. It takes the same filters as the work listings.
+func (h workHandlers[T, PT]) showSeries(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	series := h.readSeries(w, r)
+	if series == nil {
+		return
+	}
+	records, metadata, ok := h.readList(w, r, h.kind.SeriesOrder, func(filter *models.WorkFilter) {
+		filter.SeriesID = series.ID
+	})
+	if !ok {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(series.Version))
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"series": series, h.kind.Plural: records, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h workHandlers[T, PT]) patchSeries(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	series := h.readSeries(w, r)
+	if series == nil {
+		return
+	}
+	if !app.ifMatch(r, series.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+	input := *series
+	err := app.readPatch(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedPatch):
+			app.unsupportedMediaTypeResponse(w, r)
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.patchFailedResponse(w, r, err)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+	input.ID = series.ID
+	input.CreatedAt = series.CreatedAt
+	input.Version = series.Version
+
+	v := validator.New()
+	if models.ValidateSeries(v, &input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = h.series.Update(r.Context(), &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(input.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"series": &input}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h workHandlers[T, PT]) deleteSeries(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = h.series.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrSeriesInUse):
+			app.circulationConflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "series successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listSeriesWorks lists the works of the series in the URL, in series order
+// unless another sort is asked for.
+func (h workHandlers[T, PT]) listSeriesWorks(w http.ResponseWriter, r *http.Request) {
+	series := h.readSeries(w, r)
+	if series == nil {
+		return
+	}
+	h.listWhere(w, r, h.kind.SeriesOrder, func(filter *models.WorkFilter) {
+		filter.SeriesID = series.ID
+	})
+}
+
+// showNextVolumesHandler finds the next volumes of a manga series: the first
+// one the library doesn't own and, for a member, the first one they haven't
+// borrowed. The member defaults to the caller's own; naming another
+// member_id needs loans:read.
+func (app *application) showNextVolumesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	v := validator.New()
+	memberID := app.readInt64(r.URL.Query(), "member_id", 0, v)
+	if v.Check(memberID >= 0, "member_id", "must be a positive integer"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if memberID == 0 {
+		member, err := app.ownMember(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if member != nil {
+			memberID = member.ID
+		}
+	} else if !app.actsFor(r, memberID, "loans:read") {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	next, err := app.models.Volumes.Next(r.Context(), id, memberID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"next": next}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
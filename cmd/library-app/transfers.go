@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"library-app/pkg/models"
+	"library-app/pkg/validator"
+	"net/http"
+)
+
+func (app *application) createTransferHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Barcode    string `json:"barcode"`
+		ToBranchID int64  `json:"to_branch_id"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	models.ValidateBarcode(v, input.Barcode)
+	if v.Check(input.ToBranchID > 0, "to_branch_id", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	transfer, err := app.models.Transfers.Request(r.Context(), input.Barcode, input.ToBranchID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("barcode", "must belong to a copy")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrUnknownBranch):
+			v.AddError("to_branch_id", "must reference an existing branch")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrSameBranch):
+			v.AddError("to_branch_id", "must not be the branch the copy is at")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrTransferOpen):
+			app.circulationConflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/transfers/%d", transfer.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"transfer": transfer}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showTransferHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	transfer, err := app.models.Transfers.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"transfer": transfer}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		models.TransferFilter
+		models.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Status = app.readString(qs, "status", "")
+	input.FromBranchID = app.readInt64(qs, "from_branch_id", 0, v)
+	input.ToBranchID = app.readInt64(qs, "to_branch_id", 0, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "requested_at")
+	input.Filters.SortSafelist = []string{"requested_at", "-requested_at"}
+
+	models.ValidateTransferFilter(v, input.TransferFilter)
+	if models.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	transfers, metadata, err := app.models.Transfers.GetAll(r.Context(), input.TransferFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"transfers": transfers, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) shipTransferHandler(w http.ResponseWriter, r *http.Request) {
+	app.advanceTransfer(w, r, func(id int64) (*models.Transfer, error) {
+		return app.models.Transfers.Ship(r.Context(), id)
+	})
+}
+
+func (app *application) receiveTransferHandler(w http.ResponseWriter, r *http.Request) {
+	app.advanceTransfer(w, r, func(id int64) (*models.Transfer, error) {
+		return app.models.Transfers.Receive(r.Context(), id, app.config.holds.pickupDays)
+	})
+}
+
+func (app *application) cancelTransferHandler(w http.ResponseWriter, r *http.Request) {
+	app.advanceTransfer(w, r, func(id int64) (*models.Transfer, error) {
+		return app.models.Transfers.Cancel(r.Context(), id)
+	})
+}
+
+// advanceTransfer moves the transfer in the URL on to its next stage with
+// step, and answers with the transfer.
+func (app *application) advanceTransfer(w http.ResponseWriter, r *http.Request, step func(id int64) (*models.Transfer, error)) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	transfer, err := step(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrTransferStatus), errors.Is(err, models.ErrCopyUnavailable):
+			app.circulationConflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"transfer": transfer}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"library-app/pkg/models"
+	"library-app/pkg/validator"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Type string
+		models.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Type = app.readString(qs, "type", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.Filters.SortSafelist = []string{"deleted_at", "-deleted_at"}
+
+	models.ValidateTrashType(v, input.Type, app.models.Trash.TrashTypes())
+	if models.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	records, metadata, err := app.models.Trash.GetAll(r.Context(), input.Type, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"trash": records, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrash permanently deletes records that have been in the trash for
+// longer than the retention period, checking every purge interval. It runs for
+// the lifetime of the process.
+func (app *application) purgeTrash() {
+	if app.config.trash.retention <= 0 {
+		return
+	}
+	for {
+		app.purgeTrashOnce()
+		time.Sleep(app.config.trash.purgeInterval)
+	}
+}
+
+func (app *application) purgeTrashOnce() {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.PrintError(fmt.Errorf("%s", err), map[string]string{"task": "purge trash"})
+		}
+	}()
+	before := time.Now().AddDate(0, 0, -app.config.trash.retention)
+	purged, err := app.models.Trash.Purge(context.Background(), before)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"task": "purge trash"})
+		return
+	}
+	if purged > 0 {
+		app.logger.PrintInfo("purged trash", map[string]string{
+			"records": strconv.FormatInt(purged, 10),
+			"before":  before.Format(time.RFC3339),
+		})
+	}
+}
@@ -0,0 +1,575 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"library-app/pkg/jsonpatch"
+	"library-app/pkg/models"
+	"library-app/pkg/validator"
+	"net/http"
+)
+
+// workHandlers serves the catalogue endpoints of one media type. Methods can't
+// have type parameters, so the handlers hang off this struct rather than off
+// application. series is only set for the series routes.
+type workHandlers[T any, PT models.Record[T]] struct {
+	app    *application
+	kind   models.Kind[T]
+	store  models.WorkStore[T]
+	series models.SeriesStore
+}
+
+// registerWorkRoutes adds the CRUD and list routes for a media type under
+// /v1/{plural}, plus its listing under /v1/authors/:id/{plural}. They need the
+// {plural}:read or {plural}:write permission, except for the copies of a
+// work, which need copies:read or copies:write, and its holds: any activated
+// user can place one for themselves, listing them needs holds:read.
+func registerWorkRoutes[T any, PT models.Record[T]](app *application, router *httprouter.Router, kind models.Kind[T], store models.WorkStore[T]) {
+	h := workHandlers[T, PT]{app: app, kind: kind, store: store}
+
+	collection := "/v1/" + kind.Plural
+	read, write := kind.Plural+":read", kind.Plural+":write"
+	router.HandlerFunc(http.MethodGet, collection, app.requirePermission(read, h.list))
+	router.HandlerFunc(http.MethodPost, collection, app.requirePermission(write, h.create))
+	router.HandlerFunc(http.MethodGet, collection+"/:id", app.requirePermission(read, h.show))
+	router.HandlerFunc(http.MethodPut, collection+"/:id", app.requirePermission(write, h.update))
+	router.HandlerFunc(http.MethodPatch, collection+"/:id", app.requirePermission(write, h.patch))
+	router.HandlerFunc(http.MethodDelete, collection+"/:id", app.requirePermission(write, h.delete))
+	router.HandlerFunc(http.MethodPost, collection+"/:id/restore", app.requirePermission(write, h.restore))
+	router.HandlerFunc(http.MethodGet, collection+"/:id/revisions", app.requirePermission(read, h.revisions))
+	router.HandlerFunc(http.MethodPost, collection+"/:id/revisions/:rev/revert", app.requirePermission(write, h.revert))
+	router.HandlerFunc(http.MethodGet, collection+"/:id/copies", app.requirePermission("copies:read", h.listCopies))
+	router.HandlerFunc(http.MethodPost, collection+"/:id/copies", app.requirePermission("copies:write", h.createCopy))
+	router.HandlerFunc(http.MethodGet, collection+"/:id/holds", app.requirePermission("holds:read", h.listHolds))
+	router.HandlerFunc(http.MethodPost, collection+"/:id/holds", app.requireActivatedUser(h.createHold))
+	router.HandlerFunc(http.MethodGet, "/v1/authors/:id/"+kind.Plural, app.requirePermission(read, h.listByAuthor))
+}
+
+// keepSystemFields copies the fields clients can't write from the stored
+// record onto one decoded from a request body.
+func (h workHandlers[T, PT]) keepSystemFields(dst, stored *T) {
+	d, s := PT(dst).Base(), PT(stored).Base()
+	d.ID = s.ID
+	d.CreatedAt = s.CreatedAt
+	d.Availability = s.Availability
+	d.Version = s.Version
+}
+
+func (h workHandlers[T, PT]) create(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	var record T
+	err := app.readJSON(w, r, &record)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	PT(&record).Base().Availability = nil
+	if h.kind.Normalize != nil {
+		h.kind.Normalize(&record, nil)
+	}
+	v := validator.New()
+	if h.kind.Validate(v, &record); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = h.store.Insert(r.Context(), &record)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrUnknownAuthor):
+			v.AddError("creators", "must reference existing authors")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrUnknownSeries):
+			v.AddError("series_id", "must reference an existing series")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrDuplicateISBN):
+			v.AddError("isbn_13", "a book with this ISBN already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/%s/%d", h.kind.Plural, PT(&record).Base().ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{h.kind.Name: &record}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h workHandlers[T, PT]) show(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	record, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(PT(record).Base().Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{h.kind.Name: record}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h workHandlers[T, PT]) update(w http.ResponseWriter, r *http.Request) {
+	h.write(w, r, func(input *T) error {
+		// PUT replaces the record, so fields missing from the body are not
+		// carried over from the stored copy.
+		var zero T
+		*input = zero
+		return h.app.readJSON(w, r, input)
+	})
+}
+
+func (h workHandlers[T, PT]) patch(w http.ResponseWriter, r *http.Request) {
+	h.write(w, r, func(input *T) error {
+		return h.app.readPatch(w, r, input)
+	})
+}
+
+func (h workHandlers[T, PT]) revert(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	revision := app.readRevert(w, r, h.kind.Name, id)
+	if revision == nil {
+		return
+	}
+	r = r.WithContext(revertContext(r, revision))
+	h.write(w, r, func(input *T) error {
+		return revertFields(input, revision)
+	})
+}
+
+func (h workHandlers[T, PT]) revisions(w http.ResponseWriter, r *http.Request) {
+	h.app.listRevisions(w, r, h.kind.Name, func(ctx context.Context, id int64) error {
+		_, err := h.store.Get(ctx, id)
+		return err
+	})
+}
+
+// write runs a PUT or PATCH: read turns a copy of the stored record into the
+// new one from the request body, which is then validated and saved against
+// the version the client read.
+func (h workHandlers[T, PT]) write(w http.ResponseWriter, r *http.Request, read func(input *T) error) {
+	app := h.app
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	record, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !app.ifMatch(r, PT(record).Base().Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+	input := *record
+	err = read(&input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedPatch):
+			app.unsupportedMediaTypeResponse(w, r)
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.patchFailedResponse(w, r, err)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+	h.keepSystemFields(&input, record)
+	if h.kind.Normalize != nil {
+		h.kind.Normalize(&input, record)
+	}
+	v := validator.New()
+	if h.kind.Validate(v, &input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = h.store.Update(r.Context(), &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, models.ErrUnknownAuthor):
+			v.AddError("creators", "must reference existing authors")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrUnknownSeries):
+			v.AddError("series_id", "must reference an existing series")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrDuplicateISBN):
+			v.AddError("isbn_13", "a book with this ISBN already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(PT(&input).Base().Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{h.kind.Name: &input}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h workHandlers[T, PT]) delete(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = h.store.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrWorkInCirculation):
+			app.circulationConflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": h.kind.Name + " successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h workHandlers[T, PT]) restore(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	record, err := h.store.Restore(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(PT(record).Base().Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{h.kind.Name: record}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h workHandlers[T, PT]) list(w http.ResponseWriter, r *http.Request) {
+	h.listWhere(w, r, "id", func(filter *models.WorkFilter) {})
+}
+
+// listWhere serves a list request sorted on defaultSort unless the query
+// string says otherwise; scope lets a route pin filter values that come from
+// the URL path rather than from the query string.
+func (h workHandlers[T, PT]) listWhere(w http.ResponseWriter, r *http.Request, defaultSort string, scope func(filter *models.WorkFilter)) {
+	records, metadata, ok := h.readList(w, r, defaultSort, scope)
+	if !ok {
+		return
+	}
+	err := h.app.writeJSON(w, http.StatusOK, envelope{h.kind.Plural: records, "metadata": metadata}, nil)
+	if err != nil {
+		h.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readList reads the filters of a list request as listWhere does and fetches
+// the page. It sends the error response itself and reports whether it
+// didn't have to.
+func (h workHandlers[T, PT]) readList(w http.ResponseWriter, r *http.Request, defaultSort string, scope func(filter *models.WorkFilter)) ([]*T, models.Metadata, bool) {
+	app := h.app
+	var input struct {
+		models.WorkFilter
+		models.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Title = app.readString(qs, "title", "")
+	input.AuthorID = app.readInt64(qs, "author_id", 0, v)
+	input.Role = app.readString(qs, "role", "")
+	input.YearMin = int32(app.readInt(qs, "year_min", 0, v))
+	input.YearMax = int32(app.readInt(qs, "year_max", 0, v))
+	input.CreatedAfter = app.readTime(qs, "created_after", v)
+	input.CreatedBefore = app.readTime(qs, "created_before", v)
+	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.GenresAny = app.readCSV(qs, "genres_any", []string{})
+	input.GenresNone = app.readCSV(qs, "genres_none", []string{})
+	input.BranchID = app.readInt64(qs, "branch_id", 0, v)
+	if h.kind.SeriesTable != "" {
+		input.SeriesID = app.readInt64(qs, "series_id", 0, v)
+	}
+	scope(&input.WorkFilter)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+
+	input.Filters.Sort = app.readString(qs, "sort", defaultSort)
+	input.Filters.SortSafelist = h.kind.SortSafelist()
+	input.Filters.SortTypes = h.kind.SortTypes()
+
+	models.ValidateWorkFilter(v, input.WorkFilter)
+	if models.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, models.Metadata{}, false
+	}
+
+	records, metadata, err := h.store.GetAll(r.Context(), input.WorkFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, models.Metadata{}, false
+	}
+	return records, metadata, true
+}
+
+func (h workHandlers[T, PT]) listByAuthor(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.Authors.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	h.listWhere(w, r, "id", func(filter *models.WorkFilter) {
+		filter.AuthorID = id
+	})
+}
+
+// readWork looks up the work named in the URL. It sends the error response
+// itself and returns nil if there is no such work.
+func (h workHandlers[T, PT]) readWork(w http.ResponseWriter, r *http.Request) *T {
+	app := h.app
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	record, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return record
+}
+
+func (h workHandlers[T, PT]) listCopies(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	record := h.readWork(w, r)
+	if record == nil {
+		return
+	}
+	work := PT(record).Base()
+	copies, err := app.models.Copies.GetAllForWork(r.Context(), h.kind.Name, work.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"copies": copies, "availability": work.Availability}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h workHandlers[T, PT]) createCopy(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	record := h.readWork(w, r)
+	if record == nil {
+		return
+	}
+	var input struct {
+		Barcode      string       `json:"barcode"`
+		HomeBranchID int64        `json:"home_branch_id"`
+		AcquiredOn   *models.Date `json:"acquired_on"`
+		Condition    string       `json:"condition"`
+		PriceCents   *int64       `json:"price_cents"`
+		Status       string       `json:"status"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	c := &models.Copy{
+		Barcode:      input.Barcode,
+		WorkType:     h.kind.Name,
+		WorkID:       PT(record).Base().ID,
+		HomeBranchID: input.HomeBranchID,
+		AcquiredOn:   input.AcquiredOn,
+		Condition:    input.Condition,
+		PriceCents:   input.PriceCents,
+		Status:       input.Status,
+	}
+	if c.Status == "" {
+		c.Status = models.CopyAvailable
+	}
+	v := validator.New()
+	v.Check(!validator.In(c.Status, models.CopyOnLoan, models.CopyOnHold, models.CopyInTransit), "status", "must not be on_loan, on_hold or in_transit, which loans, holds and transfers manage")
+	if models.ValidateCopy(v, c); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Copies.Insert(r.Context(), c)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateBarcode):
+			v.AddError("barcode", "a copy with this barcode already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrUnknownBranch):
+			v.AddError("home_branch_id", "must reference an existing branch")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", "/v1/copies/"+c.Barcode)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"copy": c}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h workHandlers[T, PT]) listHolds(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	record := h.readWork(w, r)
+	if record == nil {
+		return
+	}
+	holds, err := app.models.Holds.GetAllForWork(r.Context(), h.kind.Name, PT(record).Base().ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"holds": holds}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createHold queues a member for the work. Users place holds for the member
+// linked to them; naming another member_id needs holds:write.
+func (h workHandlers[T, PT]) createHold(w http.ResponseWriter, r *http.Request) {
+	app := h.app
+	record := h.readWork(w, r)
+	if record == nil {
+		return
+	}
+	var input struct {
+		MemberID       int64  `json:"member_id"`
+		PickupBranchID *int64 `json:"pickup_branch_id"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.MemberID == 0 {
+		member, err := app.ownMember(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if member != nil {
+			input.MemberID = member.ID
+		}
+	}
+	v := validator.New()
+	if v.Check(input.MemberID > 0, "member_id", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if !app.actsFor(r, input.MemberID, "holds:write") {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	hold := &models.Hold{WorkType: h.kind.Name, WorkID: PT(record).Base().ID, MemberID: input.MemberID, PickupBranchID: input.PickupBranchID}
+	err = app.models.Holds.Insert(r.Context(), hold, app.loanPolicy())
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrUnknownMember):
+			v.AddError("member_id", "must reference an existing member")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrUnknownBranch):
+			v.AddError("pickup_branch_id", "must reference an existing branch")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrDuplicateHold), errors.Is(err, models.ErrMemberBlocked), errors.Is(err, models.ErrMembershipExpired), errors.Is(err, models.ErrFinesOwed):
+			app.circulationConflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/holds/%d", hold.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"hold": hold}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
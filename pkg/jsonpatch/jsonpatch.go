@@ -0,0 +1,350 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+var (
+	ErrTestFailed = errors.New("test operation failed")
+)
+
+// MergePatch applies an RFC 7396 JSON Merge Patch to doc and returns the
+// patched document.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+	return json.Marshal(mergePatch(target, p))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = mergePatch(targetObj[key], value)
+	}
+	return targetObj
+}
+
+// Apply applies an RFC 6902 JSON Patch to doc and returns the patched
+// document. Operations are applied in order and the whole patch fails if any
+// one of them does.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var ops []map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("invalid JSON patch: %w", err)
+	}
+	var root interface{}
+	if err := json.Unmarshal(doc, &root); err != nil {
+		return nil, err
+	}
+	for i, raw := range ops {
+		op, err := parseOperation(raw)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+		root, err = op.apply(root)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return json.Marshal(root)
+}
+
+type operation struct {
+	op       string
+	path     []string
+	from     []string
+	value    interface{}
+	hasValue bool
+}
+
+func parseOperation(raw map[string]json.RawMessage) (*operation, error) {
+	var op operation
+	if err := json.Unmarshal(raw["op"], &op.op); err != nil {
+		return nil, errors.New(`"op" must be a string`)
+	}
+	var path string
+	if err := json.Unmarshal(raw["path"], &path); err != nil {
+		return nil, errors.New(`"path" must be a string`)
+	}
+	var err error
+	op.path, err = parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.op {
+	case "add", "replace", "test":
+		value, ok := raw["value"]
+		if !ok {
+			return nil, fmt.Errorf("%q requires a value", op.op)
+		}
+		if err := json.Unmarshal(value, &op.value); err != nil {
+			return nil, err
+		}
+		op.hasValue = true
+	case "move", "copy":
+		var from string
+		if err := json.Unmarshal(raw["from"], &from); err != nil {
+			return nil, fmt.Errorf("%q requires a from pointer", op.op)
+		}
+		op.from, err = parsePointer(from)
+		if err != nil {
+			return nil, err
+		}
+	case "remove":
+	default:
+		return nil, fmt.Errorf("unknown op %q", op.op)
+	}
+	return &op, nil
+}
+
+func (op *operation) apply(root interface{}) (interface{}, error) {
+	switch op.op {
+	case "add":
+		return add(root, op.path, op.value)
+	case "remove":
+		root, _, err := remove(root, op.path)
+		return root, err
+	case "replace":
+		root, _, err := remove(root, op.path)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.path, op.value)
+	case "move":
+		if isPrefix(op.from, op.path) && len(op.from) < len(op.path) {
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+		root, value, err := remove(root, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.path, value)
+	case "copy":
+		value, err := get(root, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.path, deepCopy(value))
+	case "test":
+		value, err := get(root, op.path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(value, op.value) {
+			return nil, fmt.Errorf("%w at %s", ErrTestFailed, formatPointer(op.path))
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.op)
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped reference
+// tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func formatPointer(tokens []string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteString("/")
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1"))
+	}
+	return b.String()
+}
+
+func isPrefix(prefix, tokens []string) bool {
+	if len(prefix) > len(tokens) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != tokens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func get(root interface{}, tokens []string) (interface{}, error) {
+	current := root
+	for i, token := range tokens {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path %s does not exist", formatPointer(tokens[:i+1]))
+			}
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, fmt.Errorf("path %s: %w", formatPointer(tokens[:i+1]), err)
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("path %s does not exist", formatPointer(tokens[:i+1]))
+		}
+	}
+	return current, nil
+}
+
+// set replaces the value at an existing location, which is needed because
+// inserting into or removing from an array produces a new slice.
+func set(root interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parent, err := get(root, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		index, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = value
+	}
+	return root, nil
+}
+
+func add(root interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parentTokens := tokens[:len(tokens)-1]
+	parent, err := get(root, parentTokens)
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return root, nil
+	case []interface{}:
+		index := len(node)
+		if last != "-" {
+			index, err = arrayIndex(last, len(node))
+			if err != nil {
+				return nil, fmt.Errorf("path %s: %w", formatPointer(tokens), err)
+			}
+		}
+		updated := make([]interface{}, 0, len(node)+1)
+		updated = append(updated, node[:index]...)
+		updated = append(updated, value)
+		updated = append(updated, node[index:]...)
+		return set(root, parentTokens, updated)
+	default:
+		return nil, fmt.Errorf("path %s does not exist", formatPointer(parentTokens))
+	}
+}
+
+func remove(root interface{}, tokens []string) (interface{}, interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, root, nil
+	}
+	parentTokens := tokens[:len(tokens)-1]
+	parent, err := get(root, parentTokens)
+	if err != nil {
+		return nil, nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		value, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("path %s does not exist", formatPointer(tokens))
+		}
+		delete(node, last)
+		return root, value, nil
+	case []interface{}:
+		index, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, nil, fmt.Errorf("path %s: %w", formatPointer(tokens), err)
+		}
+		value := node[index]
+		updated := make([]interface{}, 0, len(node)-1)
+		updated = append(updated, node[:index]...)
+		updated = append(updated, node[index+1:]...)
+		root, err = set(root, parentTokens, updated)
+		return root, value, err
+	default:
+		return nil, nil, fmt.Errorf("path %s does not exist", formatPointer(parentTokens))
+	}
+}
+
+// arrayIndex parses an RFC 6901 array index: digits only, without leading
+// zeros.
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.Trim(token, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if index > max {
+		return 0, fmt.Errorf("array index %d out of bounds", index)
+	}
+	return index, nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = deepCopy(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = deepCopy(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
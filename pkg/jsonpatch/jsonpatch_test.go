@@ -0,0 +1,262 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func equalJSON(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("result is not JSON: %v", err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("expected value is not JSON: %v", err)
+	}
+	return reflect.DeepEqual(g, w)
+}
+
+// The first cases are the examples of RFC 6902 Appendix A, in order.
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		err   bool
+	}{
+		{
+			name:  "adding an object member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want:  `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:  "adding an array element",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want:  `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:  "removing an object member",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			want:  `{"foo": "bar"}`,
+		},
+		{
+			name:  "removing an array element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			want:  `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:  "replacing a value",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			want:  `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			name:  "moving a value",
+			doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			want:  `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name:  "moving an array element",
+			doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			want:  `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name:  "testing a value: success",
+			doc:   `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2}]`,
+			want:  `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:  "testing a value: error",
+			doc:   `{"baz": "qux"}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			err:   true,
+		},
+		{
+			name:  "adding a nested member object",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			want:  `{"foo": "bar", "child": {"grandchild": {}}}`,
+		},
+		{
+			name:  "ignoring unrecognized elements",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			want:  `{"foo": "bar", "baz": "qux"}`,
+		},
+		{
+			name:  "adding to a nonexistent target",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+			err:   true,
+		},
+		{
+			name:  "invalid JSON patch document",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "op": "remove"}]`,
+			err:   true,
+		},
+		{
+			name:  "~ escape ordering",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": 10}]`,
+			want:  `{"/": 9, "~1": 10}`,
+		},
+		{
+			name:  "comparing strings and numbers",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": "10"}]`,
+			err:   true,
+		},
+		{
+			name:  "adding an array value",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			want:  `{"foo": ["bar", ["abc", "def"]]}`,
+		},
+		{
+			name:  "escaped slash in a path",
+			doc:   `{"a/b": 1}`,
+			patch: `[{"op": "replace", "path": "/a~1b", "value": 2}]`,
+			want:  `{"a/b": 2}`,
+		},
+		{
+			name:  "- only appends",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "remove", "path": "/foo/-"}]`,
+			err:   true,
+		},
+		{
+			name:  "array index past the end",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/2", "value": "baz"}]`,
+			err:   true,
+		},
+		{
+			name:  "array index with a leading zero",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/01"}]`,
+			err:   true,
+		},
+		{
+			name:  "array index with a sign",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/+1"}]`,
+			err:   true,
+		},
+		{
+			name:  "moving a value into its own child",
+			doc:   `{"a": {"b": {}}}`,
+			patch: `[{"op": "move", "from": "/a", "path": "/a/b/c"}]`,
+			err:   true,
+		},
+		{
+			name:  "moving a value onto itself",
+			doc:   `{"a": {"b": 1}}`,
+			patch: `[{"op": "move", "from": "/a", "path": "/a"}]`,
+			want:  `{"a": {"b": 1}}`,
+		},
+		{
+			name:  "testing a nested value",
+			doc:   `{"a": {"b": [1, {"c": true}], "d": null}}`,
+			patch: `[{"op": "test", "path": "/a", "value": {"d": null, "b": [1, {"c": true}]}}]`,
+			want:  `{"a": {"b": [1, {"c": true}], "d": null}}`,
+		},
+		{
+			name:  "copying doesn't alias",
+			doc:   `{"a": {"b": 1}}`,
+			patch: `[{"op": "copy", "from": "/a", "path": "/c"}, {"op": "replace", "path": "/c/b", "value": 2}]`,
+			want:  `{"a": {"b": 1}, "c": {"b": 2}}`,
+		},
+		{
+			name:  "a failed operation fails the whole patch",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "replace", "path": "/a", "value": 2}, {"op": "remove", "path": "/b"}]`,
+			err:   true,
+		},
+		{
+			name:  "replacing the whole document",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "replace", "path": "", "value": [1]}]`,
+			want:  `[1]`,
+		},
+		{
+			name:  "unknown op",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "frob", "path": "/a"}]`,
+			err:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !equalJSON(t, got, tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTestFailed(t *testing.T) {
+	_, err := Apply([]byte(`{"baz": "qux"}`), []byte(`[{"op": "test", "path": "/baz", "value": "bar"}]`))
+	if !errors.Is(err, ErrTestFailed) {
+		t.Errorf("got %v, want ErrTestFailed", err)
+	}
+}
+
+// The cases are the examples of RFC 7396 Appendix A, in order.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+		{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+		{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+		{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+		{`{"a": "b"}`, `["c"]`, `["c"]`},
+		{`{"a": "foo"}`, `null`, `null`},
+		{`{"a": "foo"}`, `"bar"`, `"bar"`},
+		{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+		{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+		{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.doc+" "+tt.patch, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !equalJSON(t, got, tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
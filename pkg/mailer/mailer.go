@@ -0,0 +1,92 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"library-app/pkg/jsonlog"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Mailer sends the email defined by templateFile, rendered with data, to
+// recipient. Each template defines a "subject" and a "plainBody".
+type Mailer interface {
+	Send(recipient, templateFile string, data interface{}) error
+}
+
+func render(templateFile string, data interface{}) (subject, body string, err error) {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return "", "", err
+	}
+	var buf bytes.Buffer
+	err = tmpl.ExecuteTemplate(&buf, "subject", data)
+	if err != nil {
+		return "", "", err
+	}
+	subject = strings.TrimSpace(buf.String())
+	buf.Reset()
+	err = tmpl.ExecuteTemplate(&buf, "plainBody", data)
+	if err != nil {
+		return "", "", err
+	}
+	return subject, strings.TrimSpace(buf.String()), nil
+}
+
+// SMTP sends email through an SMTP server, authenticating with PLAIN auth
+// when a username is set.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Sender   string
+}
+
+func (m SMTP) Send(recipient, templateFile string, data interface{}) error {
+	subject, body, err := render(templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.Sender)
+	fmt.Fprintf(&msg, "To: %s\r\n", recipient)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	addr := fmt.Sprintf("%s:%d", m.Host, m.Port)
+	return smtp.SendMail(addr, auth, m.Sender, []string{recipient}, msg.Bytes())
+}
+
+// Log writes email to the logger instead of sending it, for development.
+type Log struct {
+	Logger *jsonlog.Logger
+}
+
+func (m Log) Send(recipient, templateFile string, data interface{}) error {
+	subject, body, err := render(templateFile, data)
+	if err != nil {
+		return err
+	}
+	m.Logger.PrintInfo("email not sent, no SMTP server configured", map[string]string{
+		"recipient": recipient,
+		"subject":   subject,
+		"body":      body,
+	})
+	return nil
+}
@@ -0,0 +1,17 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS author_id integer REFERENCES authors(id);
+ALTER TABLE mangas ADD COLUMN IF NOT EXISTS author_id integer REFERENCES authors(id);
+
+UPDATE books SET author_id = (
+    SELECT author_id FROM work_creators
+    WHERE work_type = 'book' AND work_id = books.id
+    ORDER BY role <> 'writer', position
+    LIMIT 1);
+UPDATE mangas SET author_id = (
+    SELECT author_id FROM work_creators
+    WHERE work_type = 'manga' AND work_id = mangas.id
+    ORDER BY role <> 'writer', position
+    LIMIT 1);
+ALTER TABLE books ALTER COLUMN author_id SET NOT NULL;
+ALTER TABLE mangas ALTER COLUMN author_id SET NOT NULL;
+
+DROP TABLE IF EXISTS work_creators;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS work_creators (
+                                     work_type text NOT NULL,
+                                     work_id bigint NOT NULL,
+                                     author_id bigint NOT NULL,
+                                     role text NOT NULL,
+                                     position integer NOT NULL DEFAULT 0,
+                                     PRIMARY KEY (work_type, work_id, author_id, role),
+                                     CONSTRAINT work_creators_author_fk FOREIGN KEY (author_id) REFERENCES authors(id),
+                                     CONSTRAINT work_creators_role_check CHECK (role IN ('writer', 'illustrator', 'translator', 'editor'))
+);
+CREATE INDEX IF NOT EXISTS work_creators_author_idx ON work_creators (author_id, role);
+
+INSERT INTO work_creators (work_type, work_id, author_id, role)
+SELECT 'book', id, author_id, 'writer' FROM books;
+INSERT INTO work_creators (work_type, work_id, author_id, role)
+SELECT 'manga', id, author_id, 'writer' FROM mangas;
+
+ALTER TABLE books DROP COLUMN author_id;
+ALTER TABLE mangas DROP COLUMN author_id;
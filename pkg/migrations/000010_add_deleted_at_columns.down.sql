@@ -0,0 +1,10 @@
+DELETE FROM work_creators c USING books b WHERE c.work_type = 'book' AND c.work_id = b.id AND b.deleted_at IS NOT NULL;
+DELETE FROM work_creators c USING mangas m WHERE c.work_type = 'manga' AND c.work_id = m.id AND m.deleted_at IS NOT NULL;
+DELETE FROM books WHERE deleted_at IS NOT NULL;
+DELETE FROM mangas WHERE deleted_at IS NOT NULL;
+DELETE FROM work_creators c USING authors a WHERE c.author_id = a.id AND a.deleted_at IS NOT NULL;
+DELETE FROM authors WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE books DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE mangas DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE authors DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS revisions (
+                                     id bigserial PRIMARY KEY,
+                                     record_type text NOT NULL,
+                                     record_id bigint NOT NULL,
+                                     revision integer NOT NULL,
+                                     action text NOT NULL,
+                                     actor text NOT NULL,
+                                     reason text NOT NULL DEFAULT '',
+                                     old_values jsonb,
+                                     new_values jsonb,
+                                     created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+                                     CONSTRAINT revisions_record_revision_key UNIQUE (record_type, record_id, revision),
+                                     CONSTRAINT revisions_action_check CHECK (action IN ('create', 'update', 'delete', 'restore'))
+);
@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS permissions (
+                                     id bigserial PRIMARY KEY,
+                                     code text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+                                     id bigserial PRIMARY KEY,
+                                     name text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+                                     role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+                                     permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+                                     PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+                                     user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+                                     role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+                                     PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO permissions (code)
+VALUES
+    ('books:read'),
+    ('books:write'),
+    ('manga:read'),
+    ('manga:write'),
+    ('authors:read'),
+    ('authors:write'),
+    ('trash:read'),
+    ('admin');
+
+INSERT INTO roles (name)
+VALUES
+    ('member'),
+    ('librarian'),
+    ('admin');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE (r.name = 'member' AND p.code IN ('books:read', 'manga:read', 'authors:read'))
+OR (r.name = 'librarian' AND p.code <> 'admin')
+OR r.name = 'admin';
+
+INSERT INTO users_roles (user_id, role_id)
+SELECT u.id, r.id
+FROM users u, roles r
+WHERE r.name = 'member';
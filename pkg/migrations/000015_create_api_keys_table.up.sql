@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+                                     id bigserial PRIMARY KEY,
+                                     name text NOT NULL,
+                                     prefix text NOT NULL,
+                                     hash bytea UNIQUE NOT NULL,
+                                     scopes text[] NOT NULL,
+                                     created_by bigint REFERENCES users ON DELETE SET NULL,
+                                     created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+                                     expires_at timestamp(0) with time zone,
+                                     last_used_at timestamp(0) with time zone,
+                                     revoked_at timestamp(0) with time zone,
+                                     version integer NOT NULL DEFAULT 1
+);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS copies (
+                                     id bigserial PRIMARY KEY,
+                                     barcode text UNIQUE NOT NULL,
+                                     work_type text NOT NULL,
+                                     work_id bigint NOT NULL,
+                                     acquired_on date,
+                                     condition text NOT NULL,
+                                     price_cents bigint,
+                                     status text NOT NULL DEFAULT 'available',
+                                     created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+                                     version integer NOT NULL DEFAULT 1,
+                                     CONSTRAINT copies_condition_check CHECK (condition IN ('new', 'good', 'fair', 'poor', 'damaged')),
+                                     CONSTRAINT copies_status_check CHECK (status IN ('available', 'on_loan', 'missing', 'in_repair')),
+                                     CONSTRAINT copies_price_check CHECK (price_cents >= 0)
+);
+CREATE INDEX IF NOT EXISTS copies_work_idx ON copies (work_type, work_id);
+
+INSERT INTO permissions (code)
+VALUES
+    ('copies:read'),
+    ('copies:write');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE (r.name = 'member' AND p.code = 'copies:read')
+OR (r.name IN ('librarian', 'admin') AND p.code IN ('copies:read', 'copies:write'));
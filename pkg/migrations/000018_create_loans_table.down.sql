@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code IN ('loans:read', 'loans:write');
+DROP TABLE IF EXISTS loans;
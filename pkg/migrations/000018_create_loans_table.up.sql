@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS loans (
+                                     id bigserial PRIMARY KEY,
+                                     copy_id bigint NOT NULL REFERENCES copies ON DELETE CASCADE,
+                                     member_id bigint NOT NULL REFERENCES users ON DELETE RESTRICT,
+                                     loaned_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+                                     due_at timestamp(0) with time zone NOT NULL,
+                                     returned_at timestamp(0) with time zone,
+                                     renewals integer NOT NULL DEFAULT 0,
+                                     version integer NOT NULL DEFAULT 1
+);
+CREATE UNIQUE INDEX IF NOT EXISTS loans_open_copy_idx ON loans (copy_id) WHERE returned_at IS NULL;
+CREATE INDEX IF NOT EXISTS loans_member_idx ON loans (member_id, returned_at);
+
+INSERT INTO permissions (code)
+VALUES
+    ('loans:read'),
+    ('loans:write');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('librarian', 'admin') AND p.code IN ('loans:read', 'loans:write');
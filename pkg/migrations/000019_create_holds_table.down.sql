@@ -0,0 +1,7 @@
+DELETE FROM permissions WHERE code IN ('holds:read', 'holds:write');
+
+UPDATE copies SET status = 'available' WHERE status = 'on_hold';
+ALTER TABLE copies DROP CONSTRAINT IF EXISTS copies_status_check;
+ALTER TABLE copies ADD CONSTRAINT copies_status_check CHECK (status IN ('available', 'on_loan', 'missing', 'in_repair'));
+
+DROP TABLE IF EXISTS holds;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS holds (
+                                     id bigserial PRIMARY KEY,
+                                     work_type text NOT NULL,
+                                     work_id bigint NOT NULL,
+                                     member_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+                                     status text NOT NULL DEFAULT 'waiting',
+                                     copy_id bigint REFERENCES copies ON DELETE SET NULL,
+                                     created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+                                     ready_at timestamp(0) with time zone,
+                                     expires_at timestamp(0) with time zone,
+                                     version integer NOT NULL DEFAULT 1,
+                                     CONSTRAINT holds_status_check CHECK (status IN ('waiting', 'ready', 'fulfilled', 'cancelled', 'expired'))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS holds_open_member_idx ON holds (work_type, work_id, member_id) WHERE status IN ('waiting', 'ready');
+CREATE INDEX IF NOT EXISTS holds_queue_idx ON holds (work_type, work_id, created_at, id) WHERE status = 'waiting';
+CREATE INDEX IF NOT EXISTS holds_expires_at_idx ON holds (expires_at) WHERE status = 'ready';
+
+ALTER TABLE copies DROP CONSTRAINT IF EXISTS copies_status_check;
+ALTER TABLE copies ADD CONSTRAINT copies_status_check CHECK (status IN ('available', 'on_loan', 'on_hold', 'missing', 'in_repair'));
+
+INSERT INTO permissions (code)
+VALUES
+    ('holds:read'),
+    ('holds:write');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('librarian', 'admin') AND p.code IN ('holds:read', 'holds:write');
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code IN ('fines:read', 'fines:write');
+DROP TABLE IF EXISTS fines;
+DROP FUNCTION IF EXISTS fines_append_only();
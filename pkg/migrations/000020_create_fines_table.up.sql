@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS fines (
+                                     id bigserial PRIMARY KEY,
+                                     member_id bigint NOT NULL REFERENCES users ON DELETE RESTRICT,
+                                     loan_id bigint,
+                                     kind text NOT NULL CHECK (kind IN ('charge', 'payment', 'waiver')),
+                                     amount_cents bigint NOT NULL CHECK (amount_cents > 0),
+                                     note text NOT NULL DEFAULT '',
+                                     actor text NOT NULL,
+                                     created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS fines_member_idx ON fines (member_id);
+CREATE INDEX IF NOT EXISTS fines_loan_idx ON fines (loan_id);
+CREATE INDEX IF NOT EXISTS fines_created_at_idx ON fines (created_at);
+
+-- The ledger is append-only: mistakes are put right with a new entry. loan_id
+-- has no foreign key so that charges outlive the loans and copies they were
+-- for.
+CREATE OR REPLACE FUNCTION fines_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'fines are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER fines_append_only BEFORE UPDATE OR DELETE ON fines
+    FOR EACH ROW EXECUTE FUNCTION fines_append_only();
+
+INSERT INTO permissions (code)
+VALUES
+    ('fines:read'),
+    ('fines:write');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('librarian', 'admin') AND p.code IN ('fines:read', 'fines:write');
@@ -0,0 +1,15 @@
+DELETE FROM permissions WHERE code = 'branches:write';
+
+DROP TABLE IF EXISTS transfers;
+
+ALTER TABLE holds DROP COLUMN IF EXISTS pickup_branch_id;
+
+UPDATE copies SET status = 'available' WHERE status = 'in_transit';
+ALTER TABLE copies DROP CONSTRAINT IF EXISTS copies_status_check;
+ALTER TABLE copies ADD CONSTRAINT copies_status_check CHECK (status IN ('available', 'on_loan', 'on_hold', 'missing', 'in_repair'));
+
+DROP INDEX IF EXISTS copies_current_branch_idx;
+ALTER TABLE copies DROP COLUMN IF EXISTS current_branch_id;
+ALTER TABLE copies DROP COLUMN IF EXISTS home_branch_id;
+
+DROP TABLE IF EXISTS branches;
@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS branches (
+                                     id bigserial PRIMARY KEY,
+                                     code text NOT NULL UNIQUE,
+                                     name text NOT NULL,
+                                     address text NOT NULL DEFAULT '',
+                                     created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+                                     version integer NOT NULL DEFAULT 1
+);
+
+-- Copies added before branches existed are all in the one building.
+INSERT INTO branches (code, name) VALUES ('main', 'Main branch') ON CONFLICT DO NOTHING;
+
+ALTER TABLE copies ADD COLUMN IF NOT EXISTS home_branch_id bigint REFERENCES branches ON DELETE RESTRICT;
+ALTER TABLE copies ADD COLUMN IF NOT EXISTS current_branch_id bigint REFERENCES branches ON DELETE RESTRICT;
+UPDATE copies SET
+    home_branch_id = (SELECT id FROM branches WHERE code = 'main'),
+    current_branch_id = (SELECT id FROM branches WHERE code = 'main');
+ALTER TABLE copies ALTER COLUMN home_branch_id SET NOT NULL;
+ALTER TABLE copies ALTER COLUMN current_branch_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS copies_current_branch_idx ON copies (current_branch_id, work_type, work_id);
+
+ALTER TABLE copies DROP CONSTRAINT IF EXISTS copies_status_check;
+ALTER TABLE copies ADD CONSTRAINT copies_status_check CHECK (status IN ('available', 'on_loan', 'on_hold', 'in_transit', 'missing', 'in_repair'));
+
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS pickup_branch_id bigint REFERENCES branches ON DELETE RESTRICT;
+
+CREATE TABLE IF NOT EXISTS transfers (
+                                     id bigserial PRIMARY KEY,
+                                     copy_id bigint NOT NULL REFERENCES copies ON DELETE CASCADE,
+                                     from_branch_id bigint NOT NULL REFERENCES branches ON DELETE RESTRICT,
+                                     to_branch_id bigint NOT NULL REFERENCES branches ON DELETE RESTRICT,
+                                     status text NOT NULL DEFAULT 'requested',
+                                     requested_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+                                     shipped_at timestamp(0) with time zone,
+                                     received_at timestamp(0) with time zone,
+                                     version integer NOT NULL DEFAULT 1,
+                                     CONSTRAINT transfers_status_check CHECK (status IN ('requested', 'in_transit', 'received', 'cancelled')),
+                                     CONSTRAINT transfers_branches_check CHECK (from_branch_id <> to_branch_id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS transfers_open_copy_idx ON transfers (copy_id) WHERE status IN ('requested', 'in_transit');
+CREATE INDEX IF NOT EXISTS transfers_status_idx ON transfers (status, requested_at);
+
+INSERT INTO permissions (code)
+VALUES
+    ('branches:write');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name = 'admin' AND p.code = 'branches:write';
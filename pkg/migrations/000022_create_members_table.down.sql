@@ -0,0 +1,21 @@
+DELETE FROM permissions WHERE code IN ('members:read', 'members:write');
+
+-- Records of members without a user account have nowhere to go back to.
+ALTER TABLE fines DROP CONSTRAINT IF EXISTS fines_member_id_fkey;
+ALTER TABLE fines DISABLE TRIGGER fines_append_only;
+DELETE FROM fines WHERE member_id IN (SELECT id FROM members WHERE user_id IS NULL);
+UPDATE fines SET member_id = m.user_id FROM members m WHERE m.id = fines.member_id;
+ALTER TABLE fines ENABLE TRIGGER fines_append_only;
+ALTER TABLE fines ADD CONSTRAINT fines_member_id_fkey FOREIGN KEY (member_id) REFERENCES users ON DELETE RESTRICT;
+
+ALTER TABLE holds DROP CONSTRAINT IF EXISTS holds_member_id_fkey;
+DELETE FROM holds WHERE member_id IN (SELECT id FROM members WHERE user_id IS NULL);
+UPDATE holds SET member_id = m.user_id FROM members m WHERE m.id = holds.member_id;
+ALTER TABLE holds ADD CONSTRAINT holds_member_id_fkey FOREIGN KEY (member_id) REFERENCES users ON DELETE CASCADE;
+
+ALTER TABLE loans DROP CONSTRAINT IF EXISTS loans_member_id_fkey;
+DELETE FROM loans WHERE member_id IN (SELECT id FROM members WHERE user_id IS NULL);
+UPDATE loans SET member_id = m.user_id FROM members m WHERE m.id = loans.member_id;
+ALTER TABLE loans ADD CONSTRAINT loans_member_id_fkey FOREIGN KEY (member_id) REFERENCES users ON DELETE RESTRICT;
+
+DROP TABLE IF EXISTS members;
@@ -0,0 +1,49 @@
+CREATE TABLE IF NOT EXISTS members (
+                                     id bigserial PRIMARY KEY,
+                                     card_number text NOT NULL UNIQUE,
+                                     name text NOT NULL,
+                                     membership_type text NOT NULL CHECK (membership_type IN ('adult', 'child', 'student')),
+                                     expires_on date NOT NULL,
+                                     email citext NOT NULL DEFAULT '',
+                                     phone text NOT NULL DEFAULT '',
+                                     address text NOT NULL DEFAULT '',
+                                     blocked boolean NOT NULL DEFAULT false,
+                                     blocked_reason text NOT NULL DEFAULT '',
+                                     user_id bigint UNIQUE REFERENCES users ON DELETE SET NULL,
+                                     created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+                                     version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS members_name_idx ON members USING GIN (to_tsvector('simple', name));
+
+-- Loans, holds and fines pointed at users until now. Every user who borrowed
+-- becomes a member with their user account linked, and the records follow.
+INSERT INTO members (card_number, name, membership_type, expires_on, email, user_id)
+SELECT 'U' || u.id, u.name, 'adult', (CURRENT_DATE + INTERVAL '1 year')::date, u.email, u.id
+FROM users u
+WHERE EXISTS (SELECT 1 FROM loans l WHERE l.member_id = u.id)
+OR EXISTS (SELECT 1 FROM holds h WHERE h.member_id = u.id)
+OR EXISTS (SELECT 1 FROM fines f WHERE f.member_id = u.id);
+
+ALTER TABLE loans DROP CONSTRAINT IF EXISTS loans_member_id_fkey;
+UPDATE loans SET member_id = m.id FROM members m WHERE m.user_id = loans.member_id;
+ALTER TABLE loans ADD CONSTRAINT loans_member_id_fkey FOREIGN KEY (member_id) REFERENCES members ON DELETE RESTRICT;
+
+ALTER TABLE holds DROP CONSTRAINT IF EXISTS holds_member_id_fkey;
+UPDATE holds SET member_id = m.id FROM members m WHERE m.user_id = holds.member_id;
+ALTER TABLE holds ADD CONSTRAINT holds_member_id_fkey FOREIGN KEY (member_id) REFERENCES members ON DELETE CASCADE;
+
+ALTER TABLE fines DROP CONSTRAINT IF EXISTS fines_member_id_fkey;
+ALTER TABLE fines DISABLE TRIGGER fines_append_only;
+UPDATE fines SET member_id = m.id FROM members m WHERE m.user_id = fines.member_id;
+ALTER TABLE fines ENABLE TRIGGER fines_append_only;
+ALTER TABLE fines ADD CONSTRAINT fines_member_id_fkey FOREIGN KEY (member_id) REFERENCES members ON DELETE RESTRICT;
+
+INSERT INTO permissions (code)
+VALUES
+    ('members:read'),
+    ('members:write');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('librarian', 'admin') AND p.code IN ('members:read', 'members:write');
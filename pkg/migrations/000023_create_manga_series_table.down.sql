@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS mangas_series_idx;
+ALTER TABLE mangas DROP CONSTRAINT IF EXISTS mangas_series_volume_check;
+ALTER TABLE mangas DROP COLUMN IF EXISTS release_date;
+ALTER TABLE mangas DROP COLUMN IF EXISTS volume_number;
+ALTER TABLE mangas DROP COLUMN IF EXISTS series_id;
+
+DROP TABLE IF EXISTS manga_series;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS manga_series (
+                                     id bigserial PRIMARY KEY,
+                                     title text NOT NULL,
+                                     status text NOT NULL DEFAULT 'ongoing' CHECK (status IN ('ongoing', 'completed', 'hiatus')),
+                                     created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+                                     version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS manga_series_title_idx ON manga_series USING GIN (to_tsvector('simple', title));
+
+-- A manga row is one volume. Volumes of a series carry their number; a
+-- standalone manga has neither.
+ALTER TABLE mangas ADD COLUMN IF NOT EXISTS series_id bigint REFERENCES manga_series ON DELETE RESTRICT;
+ALTER TABLE mangas ADD COLUMN IF NOT EXISTS volume_number integer CHECK (volume_number > 0);
+ALTER TABLE mangas ADD COLUMN IF NOT EXISTS release_date date;
+ALTER TABLE mangas ADD CONSTRAINT mangas_series_volume_check CHECK ((series_id IS NULL) = (volume_number IS NULL));
+CREATE INDEX IF NOT EXISTS mangas_series_idx ON mangas (series_id, volume_number);
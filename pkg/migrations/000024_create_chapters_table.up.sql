@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS chapters (
+                                     id bigserial PRIMARY KEY,
+                                     series_id bigint NOT NULL REFERENCES manga_series ON DELETE CASCADE,
+                                     number numeric(7, 1) NOT NULL CHECK (number > 0),
+                                     title text NOT NULL DEFAULT '',
+                                     release_date date,
+                                     manga_id bigint REFERENCES mangas ON DELETE SET NULL,
+                                     created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+                                     version integer NOT NULL DEFAULT 1,
+                                     UNIQUE (series_id, number)
+);
+CREATE INDEX IF NOT EXISTS chapters_manga_idx ON chapters (manga_id);
+
+CREATE TABLE IF NOT EXISTS reading_progress (
+                                     member_id bigint NOT NULL REFERENCES members ON DELETE CASCADE,
+                                     series_id bigint NOT NULL REFERENCES manga_series ON DELETE CASCADE,
+                                     last_chapter numeric(7, 1) NOT NULL CHECK (last_chapter >= 0),
+                                     updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+                                     PRIMARY KEY (member_id, series_id)
+);
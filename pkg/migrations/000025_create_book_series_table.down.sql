@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS books_series_idx;
+ALTER TABLE books DROP CONSTRAINT IF EXISTS books_series_check;
+ALTER TABLE books DROP COLUMN IF EXISTS series_position;
+ALTER TABLE books DROP COLUMN IF EXISTS series_id;
+
+DROP TABLE IF EXISTS book_series;
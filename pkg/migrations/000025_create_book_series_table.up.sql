@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS book_series (
+                                     id bigserial PRIMARY KEY,
+                                     title text NOT NULL,
+                                     status text NOT NULL DEFAULT 'ongoing' CHECK (status IN ('ongoing', 'completed', 'hiatus')),
+                                     created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+                                     version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS book_series_title_idx ON book_series USING GIN (to_tsvector('simple', title));
+
+-- Positions give the reading order, with decimals for works in between such
+-- as a novella at 2.5.
+ALTER TABLE books ADD COLUMN IF NOT EXISTS series_id bigint REFERENCES book_series ON DELETE RESTRICT;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS series_position numeric(6, 2) CHECK (series_position > 0);
+ALTER TABLE books ADD CONSTRAINT books_series_check CHECK ((series_id IS NULL) = (series_position IS NULL));
+CREATE INDEX IF NOT EXISTS books_series_idx ON books (series_id, series_position);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS books_isbn_13_key;
+ALTER TABLE books DROP CONSTRAINT IF EXISTS books_isbn_check;
+ALTER TABLE books DROP COLUMN IF EXISTS isbn_13;
+ALTER TABLE books DROP COLUMN IF EXISTS isbn_10;
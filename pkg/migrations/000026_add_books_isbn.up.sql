@@ -0,0 +1,7 @@
+-- ISBNs are stored normalised, without hyphens. Every book with an ISBN-10
+-- also has its ISBN-13, so the ISBN-13 alone identifies a book, trashed
+-- ones included.
+ALTER TABLE books ADD COLUMN IF NOT EXISTS isbn_10 text CHECK (isbn_10 ~ '^[0-9]{9}[0-9X]$');
+ALTER TABLE books ADD COLUMN IF NOT EXISTS isbn_13 text CHECK (isbn_13 ~ '^97[89][0-9]{10}$');
+ALTER TABLE books ADD CONSTRAINT books_isbn_check CHECK (isbn_10 IS NULL OR isbn_13 IS NOT NULL);
+CREATE UNIQUE INDEX IF NOT EXISTS books_isbn_13_key ON books (isbn_13);
@@ -0,0 +1,2 @@
+ALTER TABLE loans DROP CONSTRAINT IF EXISTS loans_copy_id_fkey;
+ALTER TABLE loans ADD CONSTRAINT loans_copy_id_fkey FOREIGN KEY (copy_id) REFERENCES copies ON DELETE RESTRICT;
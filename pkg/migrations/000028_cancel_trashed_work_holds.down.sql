@@ -0,0 +1,2 @@
+-- The cancelled holds can't be told apart from ones members cancelled
+-- themselves, so they stay cancelled.
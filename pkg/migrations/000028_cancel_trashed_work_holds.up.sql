@@ -0,0 +1,16 @@
+-- Deleting a work now cancels its holds; close the ones left open on works
+-- that are in the trash or already purged.
+UPDATE copies c
+SET status = 'available', version = c.version + 1
+FROM holds h
+WHERE h.copy_id = c.id AND h.status = 'ready' AND c.status = 'on_hold'
+AND (
+    (h.work_type = 'book' AND NOT EXISTS (SELECT 1 FROM books w WHERE w.id = h.work_id AND w.deleted_at IS NULL))
+    OR (h.work_type = 'manga' AND NOT EXISTS (SELECT 1 FROM mangas w WHERE w.id = h.work_id AND w.deleted_at IS NULL)));
+
+UPDATE holds h
+SET status = 'cancelled', version = h.version + 1
+WHERE h.status IN ('waiting', 'ready')
+AND (
+    (h.work_type = 'book' AND NOT EXISTS (SELECT 1 FROM books w WHERE w.id = h.work_id AND w.deleted_at IS NULL))
+    OR (h.work_type = 'manga' AND NOT EXISTS (SELECT 1 FROM mangas w WHERE w.id = h.work_id AND w.deleted_at IS NULL)));
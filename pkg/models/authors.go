@@ -3,8 +3,12 @@ package models
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
-	"time"
+	"fmt"
+	"github.com/lib/pq"
+	"library-app/pkg/validator"
+	"strings"
 )
 
 type Author struct {
@@ -12,11 +16,18 @@ type Author struct {
 	Name string `json:"name"`
 }
 
+func ValidateAuthor(v *validator.Validator, author *Author) {
+	v.Check(author.Name != "", "name", "must be provided")
+	v.Check(len(author.Name) <= 500, "name", "must not be more than 500 bytes long")
+}
+
 type AuthorModel struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Timeouts Timeouts
+	works    []workTable
 }
 
-func (m AuthorModel) Insert(author *Author) error {
+func (m AuthorModel) Insert(ctx context.Context, author *Author) error {
 
 	query := `
         INSERT INTO authors (name)
@@ -25,19 +36,39 @@ func (m AuthorModel) Insert(author *Author) error {
 
 	args := []interface{}{author.Name}
 
-	return m.DB.QueryRow(query, args...).Scan(&author.Id)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&author.Id)
+	if err != nil {
+		return err
+	}
+	err = recordRevision(ctx, tx, "author", author.Id, ActionCreate, nil, author)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (m AuthorModel) Get(id int64) (*Author, error) {
+func (m AuthorModel) Get(ctx context.Context, id int64) (*Author, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 	query := `
         SELECT id, name
         FROM authors
-        WHERE id = $1`
+        WHERE id = $1 AND deleted_at IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
 	var author Author
-	err := m.DB.QueryRow(query, id).Scan(
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
 		&author.Id,
 		&author.Name,
 	)
@@ -52,95 +83,468 @@ func (m AuthorModel) Get(id int64) (*Author, error) {
 	return &author, nil
 }
 
-func (m AuthorModel) Update(author *Author) error {
+func (m AuthorModel) Update(ctx context.Context, author *Author) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	old, err := m.lock(ctx, tx, author.Id)
+	if err != nil {
+		return err
+	}
+
 	query := `
         UPDATE authors
         SET name = $1
         WHERE id = $2`
-
-	_, err := m.DB.Exec(query, author.Name, author.Id)
+	_, err = tx.ExecContext(ctx, query, author.Name, author.Id)
 	if err != nil {
 		return err // Return the error if any occurred during the execution
 	}
+	err = recordRevision(ctx, tx, "author", author.Id, ActionUpdate, old, author)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
-	return nil
+// lock reads an author who isn't in the trash inside tx and locks their row
+// until tx ends. Inserting credits has to check the foreign key against this
+// row, so none can be added to the author in the meantime.
+func (m AuthorModel) lock(ctx context.Context, tx *sql.Tx, id int64) (*Author, error) {
+	query := `
+        SELECT id, name
+        FROM authors
+        WHERE id = $1 AND deleted_at IS NULL
+        FOR UPDATE`
+
+	var author Author
+	err := tx.QueryRowContext(ctx, query, id).Scan(
+		&author.Id,
+		&author.Name,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &author, nil
+}
+
+// Author delete strategies for authors who are still credited on works.
+// Restrict refuses to delete them, cascade deletes their works along with
+// them and reassign moves their credits to another author.
+const (
+	DeleteRestrict = "restrict"
+	DeleteCascade  = "cascade"
+	DeleteReassign = "reassign"
+)
+
+var DeleteStrategies = []string{DeleteRestrict, DeleteCascade, DeleteReassign}
+
+// AuthorDeletion says what to do with the works of an author being deleted.
+// ReassignTo is only used by the reassign strategy.
+type AuthorDeletion struct {
+	Strategy   string
+	ReassignTo int64
+}
+
+func ValidateAuthorDeletion(v *validator.Validator, id int64, d AuthorDeletion) {
+	v.Check(validator.In(d.Strategy, DeleteStrategies...), "strategy", "must be one of restrict, cascade or reassign")
+	if d.Strategy == DeleteReassign {
+		v.Check(d.ReassignTo > 0, "to", "must be provided when reassigning works")
+		v.Check(d.ReassignTo != id, "to", "must be a different author")
+	}
 }
 
-func (m AuthorModel) Delete(id int64) error {
+// CreditedWork is a work an author is credited on.
+type CreditedWork struct {
+	Type  string `json:"type"`
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Role  string `json:"role"`
+}
+
+// Delete moves an author to the trash and deals with their works as d says.
+// It returns the works that were affected, or that stopped a restricted delete
+// along with ErrAuthorHasWorks. Works already in the trash don't count.
+func (m AuthorModel) Delete(ctx context.Context, id int64, d AuthorDeletion) ([]CreditedWork, error) {
 	if id < 1 {
-		return ErrRecordNotFound
+		return nil, ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = m.lock(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	works, err := m.creditedWorks(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch d.Strategy {
+	case DeleteCascade:
+		err = m.deleteWorks(ctx, tx, works)
+	case DeleteReassign:
+		err = m.reassignWorks(ctx, tx, id, d.ReassignTo, works)
+	default:
+		if len(works) > 0 {
+			return works, ErrAuthorHasWorks
+		}
 	}
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-        DELETE FROM authors
+        UPDATE authors
+        SET deleted_at = NOW()
         WHERE id = $1`
-	result, err := m.DB.Exec(query, id)
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	err = recordRevision(ctx, tx, "author", id, ActionDelete, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return works, tx.Commit()
+}
+
+func (m AuthorModel) creditedWorks(ctx context.Context, tx *sql.Tx, id int64) ([]CreditedWork, error) {
+	selects := make([]string, len(m.works))
+	for i, work := range m.works {
+		selects[i] = fmt.Sprintf(`
+        SELECT c.work_type, c.work_id, w.title, c.role
+        FROM work_creators c JOIN %s w ON w.id = c.work_id
+        WHERE c.work_type = %s AND c.author_id = $1 AND w.deleted_at IS NULL`, work.Table, pq.QuoteLiteral(work.Type))
+	}
+	query := strings.Join(selects, "\n        UNION ALL") + `
+        ORDER BY 1, 2, 4`
+
+	rows, err := tx.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	works := []CreditedWork{}
+	for rows.Next() {
+		var work CreditedWork
+		err := rows.Scan(&work.Type, &work.ID, &work.Title, &work.Role)
+		if err != nil {
+			return nil, err
+		}
+		works = append(works, work)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return works, nil
+}
+
+// workIDs groups the ids of works by their work type.
+func workIDs(works []CreditedWork) map[string][]int64 {
+	ids := make(map[string][]int64)
+	for _, work := range works {
+		ids[work.Type] = append(ids[work.Type], work.ID)
+	}
+	return ids
+}
+
+// deleteWorks moves works to the trash along with their author. Their credits
+// stay so that restoring a work brings its creators back too, while their open
+// holds are cancelled. It returns ErrWorkInCirculation if copies of any of
+// them are on loan.
+func (m AuthorModel) deleteWorks(ctx context.Context, tx *sql.Tx, works []CreditedWork) error {
+	ids := workIDs(works)
+	for _, work := range m.works {
+		if len(ids[work.Type]) == 0 {
+			continue
+		}
+		query := fmt.Sprintf(`
+        UPDATE %s
+        SET deleted_at = NOW(), version = version + 1
+        WHERE id = ANY($1) AND deleted_at IS NULL`, work.Table)
+		_, err := tx.ExecContext(ctx, query, pq.Array(ids[work.Type]))
+		if err != nil {
+			return err
+		}
+		err = cancelHolds(ctx, tx, work.Type, ids[work.Type])
+		if err != nil {
+			return err
+		}
+		err = checkCirculation(ctx, tx, work.Type, ids[work.Type])
+		if err != nil {
+			return err
+		}
+		for _, id := range ids[work.Type] {
+			err = recordRevision(ctx, tx, work.Type, id, ActionDelete, nil, nil)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reassignWorks moves the credits of author id on works to author to. A
+// credit the target already holds on the same work with the same role is
+// dropped rather than duplicated. The works' versions are bumped as their
+// creators changed. Credits on works in the trash stay with author id, so
+// that restoring one of them gives it back the creators it was deleted with.
+// The target is locked so that it can't be deleted while taking the credits.
+func (m AuthorModel) reassignWorks(ctx context.Context, tx *sql.Tx, id, to int64, works []CreditedWork) error {
+	query := `
+        SELECT id
+        FROM authors
+        WHERE id = $1 AND deleted_at IS NULL
+        FOR SHARE`
+	err := tx.QueryRowContext(ctx, query, to).Scan(&to)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrUnknownAuthor
+		default:
+			return err
+		}
+	}
+
+	ids := workIDs(works)
+	before := make(map[string]map[int64]json.RawMessage)
+	for _, work := range m.works {
+		before[work.Type], err = m.creators(ctx, tx, work, ids[work.Type])
+		if err != nil {
+			return err
+		}
+	}
+
+	creditTypes := make([]string, len(works))
+	creditIDs := make([]int64, len(works))
+	for i, work := range works {
+		creditTypes[i] = work.Type
+		creditIDs[i] = work.ID
+	}
+
+	query = `
+        UPDATE work_creators c
+        SET author_id = $2
+        WHERE c.author_id = $1
+        AND (c.work_type, c.work_id) IN (SELECT * FROM unnest($3::text[], $4::bigint[]))
+        AND NOT EXISTS (
+            SELECT 1 FROM work_creators t
+            WHERE t.work_type = c.work_type AND t.work_id = c.work_id AND t.role = c.role AND t.author_id = $2)`
+	_, err = tx.ExecContext(ctx, query, id, to, pq.Array(creditTypes), pq.Array(creditIDs))
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
+	query = `
+        DELETE FROM work_creators c
+        WHERE c.author_id = $1
+        AND (c.work_type, c.work_id) IN (SELECT * FROM unnest($2::text[], $3::bigint[]))`
+	_, err = tx.ExecContext(ctx, query, id, pq.Array(creditTypes), pq.Array(creditIDs))
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+
+	for _, work := range m.works {
+		if len(ids[work.Type]) == 0 {
+			continue
+		}
+		query := fmt.Sprintf(`
+        UPDATE %s
+        SET version = version + 1
+        WHERE id = ANY($1)`, work.Table)
+		_, err = tx.ExecContext(ctx, query, pq.Array(ids[work.Type]))
+		if err != nil {
+			return err
+		}
+		after, err := m.creators(ctx, tx, work, ids[work.Type])
+		if err != nil {
+			return err
+		}
+		for _, id := range ids[work.Type] {
+			old := map[string]json.RawMessage{"creators": before[work.Type][id]}
+			new := map[string]json.RawMessage{"creators": after[id]}
+			err = recordRevision(ctx, tx, work.Type, id, ActionUpdate, old, new)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-func (m AuthorModel) GetAll(Name string, id int64, filters Filters) ([]*Author, error) {
+// creators reads the creators of the given works, keyed by work id.
+func (m AuthorModel) creators(ctx context.Context, tx *sql.Tx, work workTable, ids []int64) (map[int64]json.RawMessage, error) {
+	creators := make(map[int64]json.RawMessage)
+	if len(ids) == 0 {
+		return creators, nil
+	}
+	query := fmt.Sprintf(`
+        SELECT id, %s
+        FROM %s
+        WHERE id = ANY($1)`, creatorsColumn(work.Type, work.Table), work.Table)
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var js []byte
+		err := rows.Scan(&id, &js)
+		if err != nil {
+			return nil, err
+		}
+		creators[id] = js
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return creators, nil
+}
+
+// Restore takes an author back out of the trash. Works deleted along with
+// them are restored separately.
+func (m AuthorModel) Restore(ctx context.Context, id int64) (*Author, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
 	query := `
-        SELECT id, name
-        FROM authors
-        WHERE (LOWER(name) = LOWER($1) OR $1 = '')      
-        ORDER BY id`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+        UPDATE authors
+        SET deleted_at = NULL
+        WHERE id = $1 AND deleted_at IS NOT NULL
+        RETURNING id, name`
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
 	defer cancel()
-	// Pass the title and genres as the placeholder parameter values.
-	rows, err := m.DB.QueryContext(ctx, query, Name)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	var author Author
+	err = tx.QueryRowContext(ctx, query, id).Scan(
+		&author.Id,
+		&author.Name,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	err = recordRevision(ctx, tx, "author", id, ActionRestore, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &author, tx.Commit()
+}
+
+func (m AuthorModel) GetAll(ctx context.Context, name string, filters Filters) ([]*Author, Metadata, error) {
+	where := &where{conditions: []string{"deleted_at IS NULL"}}
+	if name != "" {
+		where.add("name ILIKE '%%' || %s || '%%'", escapeLike(name))
+	}
+	column := filters.sortColumn()
+	count, limit, offset := filters.paginate(where, column)
+	query := fmt.Sprintf(`
+        SELECT %s, id, name, %s
+        FROM authors
+        %s
+        ORDER BY %s
+        LIMIT %s OFFSET %s`, count, column, where, filters.orderBy(column), limit, offset)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Search)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
 	defer rows.Close()
+
+	p := pager{filters: filters}
 	authors := []*Author{}
 	for rows.Next() {
 		var author Author
+		var sortKey interface{}
 		err := rows.Scan(
+			&p.total,
 			&author.Id,
 			&author.Name,
+			&sortKey,
 		)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
+		}
+		if !p.add(sortKey, author.Id) {
+			break
 		}
 		authors = append(authors, &author)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
-	return authors, nil
+
+	return authors, p.metadata(), nil
+}
+
+// escapeLike escapes the LIKE wildcards in s so that it only ever matches
+// literally inside a pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
 
 type MockAuthorModel struct{}
 
-func (m MockAuthorModel) Insert(author *Author) error {
+func (m MockAuthorModel) Insert(ctx context.Context, author *Author) error {
 	// Мокируем действие...
 	return nil
 }
 
-func (m MockAuthorModel) Get(id int64) (*Author, error) {
+func (m MockAuthorModel) Get(ctx context.Context, id int64) (*Author, error) {
 	// Мокируем действие...
 	return nil, nil
 }
 
-func (m MockAuthorModel) Update(author *Author) error {
+func (m MockAuthorModel) Update(ctx context.Context, author *Author) error {
 	// Мокируем действие...
 	return nil
 }
 
-func (m MockAuthorModel) Delete(id int64) error {
+func (m MockAuthorModel) Delete(ctx context.Context, id int64, d AuthorDeletion) ([]CreditedWork, error) {
 	// Мокируем действие...
-	return nil
+	return nil, nil
 }
 
-func (m MockAuthorModel) GetAll(Name string, id int64, filters Filters) ([]*Author, error) {
+func (m MockAuthorModel) Restore(ctx context.Context, id int64) (*Author, error) {
+	// Мокируем действие...
 	return nil, nil
 }
+
+func (m MockAuthorModel) GetAll(ctx context.Context, name string, filters Filters) ([]*Author, Metadata, error) {
+	return nil, Metadata{}, nil
+}
@@ -2,186 +2,147 @@ package models
 
 import (
 	"context"
-	"database/sql"
 	"errors"
-	"fmt"
 	"github.com/lib/pq"
 	"library-app/pkg/validator"
-	"time"
 )
 
-type Book struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	AuthorId  int64     `json:"author_id,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
-}
+var ErrDuplicateISBN = errors.New("duplicate isbn")
 
-func ValidateBook(v *validator.Validator, book *Book) {
-	v.Check(book.Title != "", "title", "must be provided")
-	v.Check(len(book.Title) <= 500, "title", "must not be more than 500 bytes long")
-	v.Check(book.Year != 0, "year", "must be provided")
-	v.Check(book.Year >= 1888, "year", "must be greater than 1888")
-	v.Check(book.Year <= int32(time.Now().Year()), "year", "must not be in the future")
-	v.Check(book.Genres != nil, "genres", "must be provided")
-	v.Check(len(book.Genres) >= 1, "genres", "must contain at least 1 genre")
-	v.Check(len(book.Genres) <= 5, "genres", "must not contain more than 5 genres")
-	v.Check(validator.Unique(book.Genres), "genres", "must not contain duplicate values")
+// Book is one work. A book in a series names it with SeriesID and has a
+// SeriesPosition giving the reading order, which can be fractional for works
+// in between, such as a novella at 2.5. ISBNs are kept normalised, and a
+// book with an ISBN-10 always has the matching ISBN-13, which is the one
+// lookups go by.
+type Book struct {
+	Work
+	SeriesID       *int64   `json:"series_id,omitempty"`
+	SeriesPosition *float64 `json:"series_position,omitempty"`
+	ISBN10         *string  `json:"isbn_10,omitempty"`
+	ISBN13         *string  `json:"isbn_13,omitempty"`
 }
 
-type BookModel struct {
-	DB *sql.DB
+// NormalizeBook normalises the ISBNs of a book, drops empty ones and fills in
+// the ISBN-13 from a valid ISBN-10. When an edit changes the ISBN-10 but
+// leaves the ISBN-13 as stored, the ISBN-13 is worked out again.
+func NormalizeBook(book, stored *Book) {
+	book.ISBN10 = normalizeISBN(book.ISBN10)
+	book.ISBN13 = normalizeISBN(book.ISBN13)
+	if stored != nil && book.ISBN10 != nil && !sameISBN(book.ISBN10, stored.ISBN10) && sameISBN(book.ISBN13, stored.ISBN13) {
+		book.ISBN13 = nil
+	}
+	if book.ISBN10 != nil && book.ISBN13 == nil && validator.ValidISBN10(*book.ISBN10) {
+		isbn := validator.ISBN10To13(*book.ISBN10)
+		book.ISBN13 = &isbn
+	}
 }
 
-func (m BookModel) Insert(book *Book) error {
-
-	query := `
-        INSERT INTO books (title, year, author_id, genres)
-        VALUES ($1, $2, $3, $4)
-        RETURNING id, created_at, version`
-
-	args := []interface{}{book.Title, book.Year, book.AuthorId, pq.Array(book.Genres)}
-
-	return m.DB.QueryRow(query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version)
+func sameISBN(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
 
-func (m BookModel) Get(id int64) (*Book, error) {
-	if id < 1 {
-		return nil, ErrRecordNotFound
+func normalizeISBN(isbn *string) *string {
+	if isbn == nil {
+		return nil
 	}
-	query := `
-        SELECT id, created_at, title, year, author_id, genres, version
-        FROM books
-        WHERE id = $1`
-	var book Book
-	err := m.DB.QueryRow(query, id).Scan(
-		&book.ID,
-		&book.CreatedAt,
-		&book.Title,
-		&book.Year,
-		&book.AuthorId,
-		pq.Array(&book.Genres),
-		&book.Version,
-	)
-	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrRecordNotFound
-		default:
-			return nil, err
-		}
+	normalized := validator.NormalizeISBN(*isbn)
+	if normalized == "" {
+		return nil
 	}
-	return &book, nil
+	return &normalized
 }
 
-func (m BookModel) Update(book *Book) error {
-	query := `
-        UPDATE books 
-        SET title = $1, year = $2, author_id = $3, genres = $4, version = version + 1
-        WHERE id = $5
-        RETURNING version`
-	args := []interface{}{
-		book.Title,
-		book.Year,
-		book.AuthorId,
-		pq.Array(book.Genres),
-		book.ID,
+func ValidateBook(v *validator.Validator, book *Book) {
+	ValidateWork(v, &book.Work)
+	if book.SeriesID != nil {
+		v.Check(*book.SeriesID > 0, "series_id", "must be a positive integer")
+		v.Check(book.SeriesPosition != nil, "series_position", "must be provided for a book in a series")
 	}
-	return m.DB.QueryRow(query, args...).Scan(&book.Version)
-}
-
-func (m BookModel) Delete(id int64) error {
-	if id < 1 {
-		return ErrRecordNotFound
+	if book.SeriesPosition != nil {
+		v.Check(book.SeriesID != nil, "series_id", "must be provided for a book with a series position")
+		v.Check(*book.SeriesPosition > 0, "series_position", "must be greater than zero")
+		v.Check(*book.SeriesPosition <= 9999.99, "series_position", "must not be more than 9999.99")
+		v.Check(validator.MaxDecimals(*book.SeriesPosition, 2), "series_position", "must not have more than two decimal places")
 	}
-	query := `
-        DELETE FROM books
-        WHERE id = $1`
-	result, err := m.DB.Exec(query, id)
-	if err != nil {
-		return err
+	if book.ISBN10 != nil {
+		v.Check(validator.ValidISBN10(*book.ISBN10), "isbn_10", "must be a valid ISBN-10")
 	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
+	if book.ISBN13 != nil {
+		v.Check(validator.ValidISBN13(*book.ISBN13), "isbn_13", "must be a valid ISBN-13")
 	}
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	if book.ISBN10 != nil && book.ISBN13 != nil && validator.ValidISBN10(*book.ISBN10) {
+		v.Check(validator.ISBN10To13(*book.ISBN10) == *book.ISBN13, "isbn_13", "must match isbn_10")
 	}
-	return nil
 }
 
-func (m BookModel) GetAll(title string, genres []string, filters Filters) ([]*Book, Metadata, error) {
-	query := fmt.Sprintf(`
-        SELECT count(*) OVER(), id, created_at, title, year, author_id, genres, version
-        FROM books
-        WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '') 
-        AND (genres @> $2 OR $2 = '{}')     
-        ORDER BY %s %s, id ASC
-        LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	args := []interface{}{title, pq.Array(genres), filters.limit(), filters.offset()}
-
-	rows, err := m.DB.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, Metadata{}, err
-	}
-	defer rows.Close()
-
-	totalRecords := 0
-	books := []*Book{}
-	for rows.Next() {
-		var book Book
-		err := rows.Scan(
-			&totalRecords,
-			&book.ID,
-			&book.CreatedAt,
-			&book.Title,
-			&book.Year,
-			&book.AuthorId,
-			pq.Array(&book.Genres),
-			&book.Version,
-		)
-		if err != nil {
-			return nil, Metadata{}, err
-		}
-		books = append(books, &book)
-	}
-	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
-	}
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+func isDuplicateISBN(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Constraint == "books_isbn_13_key"
+}
 
-	return books, metadata, nil
+var BookKind = Kind[Book]{
+	Name:        "book",
+	Plural:      "books",
+	Table:       "books",
+	SeriesTable: "book_series",
+	SeriesOrder: "series_position",
+	Normalize:   NormalizeBook,
+	Validate:    ValidateBook,
+	Fields: []Field[Book]{
+		{
+			Column: "series_id",
+			Value:  func(book *Book) interface{} { return book.SeriesID },
+			Scan:   func(book *Book) interface{} { return &book.SeriesID },
+		},
+		{
+			Column:   "series_position",
+			Sortable: true,
+			SortType: "numeric",
+			Value:    func(book *Book) interface{} { return book.SeriesPosition },
+			Scan:     func(book *Book) interface{} { return &book.SeriesPosition },
+		},
+		{
+			Column: "isbn_10",
+			Value:  func(book *Book) interface{} { return book.ISBN10 },
+			Scan:   func(book *Book) interface{} { return &book.ISBN10 },
+		},
+		{
+			Column: "isbn_13",
+			Value:  func(book *Book) interface{} { return book.ISBN13 },
+			Scan:   func(book *Book) interface{} { return &book.ISBN13 },
+		},
+	},
 }
 
-type MockBookModel struct{}
+var BookFormat = WorkFormat[Book, *Book]{
+	Kind:  BookKind,
+	Store: func(m WorkModel[Book, *Book]) WorkStore[Book] { return BookModel{m} },
+	Mock:  MockBookModel{},
+}
 
-func (m MockBookModel) Insert(book *Book) error {
-	// Мокируем действие...
-	return nil
+// BookStore adds the lookups only books have to WorkStore.
+type BookStore interface {
+	WorkStore[Book]
+	GetByISBN(ctx context.Context, isbn13 string) (*Book, error)
 }
 
-func (m MockBookModel) Get(id int64) (*Book, error) {
-	// Мокируем действие...
-	return nil, nil
+type BookModel struct {
+	WorkModel[Book, *Book]
 }
 
-func (m MockBookModel) Update(book *Book) error {
-	// Мокируем действие...
-	return nil
+// GetByISBN finds the book, outside the trash, with a normalised ISBN-13.
+func (m BookModel) GetByISBN(ctx context.Context, isbn13 string) (*Book, error) {
+	return m.get(ctx, "isbn_13 = $1", isbn13)
 }
 
-func (m MockBookModel) Delete(id int64) error {
-	// Мокируем действие...
-	return nil
+type MockBookModel struct {
+	MockWorkModel[Book]
 }
 
-func (m MockBookModel) GetAll(title string, genres []string, filters Filters) ([]*Book, Metadata, error) {
-	return nil, Metadata{}, nil
+func (m MockBookModel) GetByISBN(ctx context.Context, isbn13 string) (*Book, error) {
+	// Мокируем действие...
+	return nil, nil
 }
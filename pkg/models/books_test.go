@@ -0,0 +1,128 @@
+package models
+
+import "testing"
+
+func str(s string) *string {
+	return &s
+}
+
+func TestNormalizeBook(t *testing.T) {
+	stored := &Book{ISBN10: str("0306406152"), ISBN13: str("9780306406157")}
+
+	tests := []struct {
+		name       string
+		isbn10     *string
+		isbn13     *string
+		stored     *Book
+		wantISBN10 *string
+		wantISBN13 *string
+	}{
+		{
+			name:       "new book with an ISBN-10",
+			isbn10:     str("0-306-40615-2"),
+			wantISBN10: str("0306406152"),
+			wantISBN13: str("9780306406157"),
+		},
+		{
+			name:       "new book with a lowercase x check digit",
+			isbn10:     str("0-8044-2957-x"),
+			wantISBN10: str("080442957X"),
+			wantISBN13: str("9780804429573"),
+		},
+		{
+			name:       "new book with a 979 ISBN-13 only",
+			isbn13:     str("979-10-323-0082-4"),
+			wantISBN13: str("9791032300824"),
+		},
+		{
+			name:       "new book with an invalid ISBN-10",
+			isbn10:     str("0306406153"),
+			wantISBN10: str("0306406153"),
+		},
+		{
+			name:       "new book with both given",
+			isbn10:     str("0306406152"),
+			isbn13:     str("9780345391803"),
+			wantISBN10: str("0306406152"),
+			wantISBN13: str("9780345391803"),
+		},
+		{
+			name:   "empty ISBNs",
+			isbn10: str(" "),
+			isbn13: str(""),
+		},
+		{
+			name:       "update changing neither",
+			isbn10:     str("0-306-40615-2"),
+			isbn13:     str("9780306406157"),
+			stored:     stored,
+			wantISBN10: str("0306406152"),
+			wantISBN13: str("9780306406157"),
+		},
+		{
+			name:       "update changing the ISBN-10 alone",
+			isbn10:     str("0345391802"),
+			isbn13:     str("9780306406157"),
+			stored:     stored,
+			wantISBN10: str("0345391802"),
+			wantISBN13: str("9780345391803"),
+		},
+		{
+			name:       "update changing both",
+			isbn10:     str("0345391802"),
+			isbn13:     str("9780804429573"),
+			stored:     stored,
+			wantISBN10: str("0345391802"),
+			wantISBN13: str("9780804429573"),
+		},
+		{
+			name:       "update changing the ISBN-13 alone",
+			isbn10:     str("0306406152"),
+			isbn13:     str("9780345391803"),
+			stored:     stored,
+			wantISBN10: str("0306406152"),
+			wantISBN13: str("9780345391803"),
+		},
+		{
+			name:       "update removing the ISBN-10",
+			isbn13:     str("9780306406157"),
+			stored:     stored,
+			wantISBN13: str("9780306406157"),
+		},
+		{
+			name:       "update removing the ISBN-13",
+			isbn10:     str("0306406152"),
+			stored:     stored,
+			wantISBN10: str("0306406152"),
+			wantISBN13: str("9780306406157"),
+		},
+		{
+			name:       "update adding an ISBN-10 to a 979 ISBN-13",
+			isbn10:     str("0345391802"),
+			isbn13:     str("9791032300824"),
+			stored:     &Book{ISBN13: str("9791032300824")},
+			wantISBN10: str("0345391802"),
+			wantISBN13: str("9780345391803"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := &Book{ISBN10: tt.isbn10, ISBN13: tt.isbn13}
+			NormalizeBook(book, tt.stored)
+			if !sameISBN(book.ISBN10, tt.wantISBN10) {
+				t.Errorf("got isbn_10 %s, want %s", show(book.ISBN10), show(tt.wantISBN10))
+			}
+			if !sameISBN(book.ISBN13, tt.wantISBN13) {
+				t.Errorf("got isbn_13 %s, want %s", show(book.ISBN13), show(tt.wantISBN13))
+			}
+		})
+	}
+}
+
+func show(s *string) string {
+	if s == nil {
+		return "nil"
+	}
+	return *s
+}
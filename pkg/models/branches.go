@@ -0,0 +1,225 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"library-app/pkg/validator"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDuplicateBranchCode = errors.New("duplicate branch code")
+	ErrUnknownBranch       = errors.New("unknown branch")
+	ErrBranchInUse         = errors.New("branch still has copies, holds or transfers")
+)
+
+var BranchCodeRX = regexp.MustCompile("^[a-z0-9-]+$")
+
+// Branch is one building of the library. Code is a short name for it, such
+// as "main".
+type Branch struct {
+	ID        int64     `json:"id"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	Address   string    `json:"address,omitempty"`
+	CreatedAt time.Time `json:"-"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateBranch(v *validator.Validator, branch *Branch) {
+	v.Check(branch.Code != "", "code", "must be provided")
+	v.Check(len(branch.Code) <= 32, "code", "must not be more than 32 bytes long")
+	v.Check(validator.Matches(branch.Code, BranchCodeRX), "code", "must only contain lowercase letters, digits and dashes")
+	v.Check(branch.Name != "", "name", "must be provided")
+	v.Check(len(branch.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(branch.Address) <= 500, "address", "must not be more than 500 bytes long")
+}
+
+func isDuplicateBranchCode(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Constraint == "branches_code_key"
+}
+
+// isBranchReference reports whether err breaks one of the foreign keys to
+// branches: a write naming a branch that doesn't exist, or the deletion of
+// one that is still named.
+func isBranchReference(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503" && strings.HasSuffix(pqErr.Constraint, "branch_id_fkey")
+}
+
+type BranchModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+const branchColumns = "id, code, name, address, created_at, version"
+
+func branchDest(branch *Branch) []interface{} {
+	return []interface{}{
+		&branch.ID,
+		&branch.Code,
+		&branch.Name,
+		&branch.Address,
+		&branch.CreatedAt,
+		&branch.Version,
+	}
+}
+
+func (m BranchModel) Insert(ctx context.Context, branch *Branch) error {
+	query := `
+        INSERT INTO branches (code, name, address)
+        VALUES ($1, $2, $3)
+        RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, branch.Code, branch.Name, branch.Address).Scan(&branch.ID, &branch.CreatedAt, &branch.Version)
+	if err != nil {
+		switch {
+		case isDuplicateBranchCode(err):
+			return ErrDuplicateBranchCode
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m BranchModel) Get(ctx context.Context, id int64) (*Branch, error) {
+	query := `
+        SELECT ` + branchColumns + `
+        FROM branches
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var branch Branch
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(branchDest(&branch)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &branch, nil
+}
+
+// GetAll lists every branch by code. A library has a handful of them, so
+// there is no paging.
+func (m BranchModel) GetAll(ctx context.Context) ([]*Branch, error) {
+	query := `
+        SELECT ` + branchColumns + `
+        FROM branches
+        ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Search)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	branches := []*Branch{}
+	for rows.Next() {
+		var branch Branch
+		err := rows.Scan(branchDest(&branch)...)
+		if err != nil {
+			return nil, err
+		}
+		branches = append(branches, &branch)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return branches, nil
+}
+
+func (m BranchModel) Update(ctx context.Context, branch *Branch) error {
+	query := `
+        UPDATE branches
+        SET code = $1, name = $2, address = $3, version = version + 1
+        WHERE id = $4 AND version = $5
+        RETURNING version`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, branch.Code, branch.Name, branch.Address, branch.ID, branch.Version).Scan(&branch.Version)
+	if err != nil {
+		switch {
+		case isDuplicateBranchCode(err):
+			return ErrDuplicateBranchCode
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a branch. It returns ErrBranchInUse while any copy, hold or
+// transfer still names it.
+func (m BranchModel) Delete(ctx context.Context, id int64) error {
+	query := `
+        DELETE FROM branches
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		switch {
+		case isBranchReference(err):
+			return ErrBranchInUse
+		default:
+			return err
+		}
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+type MockBranchModel struct{}
+
+func (m MockBranchModel) Insert(ctx context.Context, branch *Branch) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockBranchModel) Get(ctx context.Context, id int64) (*Branch, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockBranchModel) GetAll(ctx context.Context) ([]*Branch, error) {
+	return nil, nil
+}
+
+func (m MockBranchModel) Update(ctx context.Context, branch *Branch) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockBranchModel) Delete(ctx context.Context, id int64) error {
+	// Мокируем действие...
+	return nil
+}
@@ -0,0 +1,414 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"library-app/pkg/validator"
+	"time"
+)
+
+var (
+	ErrDuplicateChapter = errors.New("duplicate chapter number")
+	ErrUnknownVolume    = errors.New("unknown volume")
+)
+
+// Chapter is one chapter of a manga series. Chapters are numbered within
+// their series, with one decimal for extras such as 10.5. MangaID names the
+// volume that collects the chapter, once there is one.
+type Chapter struct {
+	ID          int64     `json:"id"`
+	SeriesID    int64     `json:"series_id"`
+	Number      float64   `json:"number"`
+	Title       string    `json:"title,omitempty"`
+	ReleaseDate *Date     `json:"release_date,omitempty"`
+	MangaID     *int64    `json:"manga_id,omitempty"`
+	CreatedAt   time.Time `json:"-"`
+	Version     int32     `json:"version"`
+}
+
+func ValidateChapter(v *validator.Validator, chapter *Chapter) {
+	v.Check(chapter.Number > 0, "number", "must be greater than zero")
+	v.Check(chapter.Number <= 999999.9, "number", "must not be more than 999999.9")
+	v.Check(validator.MaxDecimals(chapter.Number, 1), "number", "must not have more than one decimal place")
+	v.Check(len(chapter.Title) <= 500, "title", "must not be more than 500 bytes long")
+	if chapter.MangaID != nil {
+		v.Check(*chapter.MangaID > 0, "manga_id", "must be a positive integer")
+	}
+}
+
+func isDuplicateChapter(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Constraint == "chapters_series_id_number_key"
+}
+
+type ChapterModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+const chapterColumns = "id, series_id, number, title, release_date, manga_id, created_at, version"
+
+func chapterDest(chapter *Chapter) []interface{} {
+	return []interface{}{
+		&chapter.ID,
+		&chapter.SeriesID,
+		&chapter.Number,
+		&chapter.Title,
+		&chapter.ReleaseDate,
+		&chapter.MangaID,
+		&chapter.CreatedAt,
+		&chapter.Version,
+	}
+}
+
+// checkVolume makes sure the volume collecting a chapter belongs to the
+// chapter's series and isn't in the trash.
+func checkVolume(ctx context.Context, tx *sql.Tx, chapter *Chapter) error {
+	if chapter.MangaID == nil {
+		return nil
+	}
+	query := `
+        SELECT EXISTS (
+            SELECT 1 FROM mangas
+            WHERE id = $1 AND series_id = $2 AND deleted_at IS NULL)`
+	var ok bool
+	err := tx.QueryRowContext(ctx, query, *chapter.MangaID, chapter.SeriesID).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrUnknownVolume
+	}
+	return nil
+}
+
+// Insert adds a chapter to its series. It returns ErrRecordNotFound if there
+// is no such series, ErrDuplicateChapter if the series already has a chapter
+// with the number and ErrUnknownVolume if the volume isn't one of the series.
+func (m ChapterModel) Insert(ctx context.Context, chapter *Chapter) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkVolume(ctx, tx, chapter)
+	if err != nil {
+		return err
+	}
+	query := `
+        INSERT INTO chapters (series_id, number, title, release_date, manga_id)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, created_at, version`
+	args := []interface{}{chapter.SeriesID, chapter.Number, chapter.Title, chapter.ReleaseDate, chapter.MangaID}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&chapter.ID, &chapter.CreatedAt, &chapter.Version)
+	if err != nil {
+		switch {
+		case isDuplicateChapter(err):
+			return ErrDuplicateChapter
+		case isSeriesReference(err):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (m ChapterModel) Get(ctx context.Context, id int64) (*Chapter, error) {
+	query := `
+        SELECT ` + chapterColumns + `
+        FROM chapters
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var chapter Chapter
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(chapterDest(&chapter)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &chapter, nil
+}
+
+// GetAllForSeries lists the chapters of a series, sorted by filters on
+// number or release_date.
+func (m ChapterModel) GetAllForSeries(ctx context.Context, seriesID int64, filters Filters) ([]*Chapter, Metadata, error) {
+	w := &where{}
+	w.add("series_id = %s", seriesID)
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), %s
+        FROM chapters
+        %s
+        ORDER BY %s %s, number ASC
+        LIMIT %s OFFSET %s`, chapterColumns, w, filters.sortColumn(), filters.sortDirection(), w.arg(filters.limit()), w.arg(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Search)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, w.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	chapters := []*Chapter{}
+	for rows.Next() {
+		var chapter Chapter
+		err := rows.Scan(append([]interface{}{&totalRecords}, chapterDest(&chapter)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		chapters = append(chapters, &chapter)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return chapters, metadata, nil
+}
+
+func (m ChapterModel) Update(ctx context.Context, chapter *Chapter) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkVolume(ctx, tx, chapter)
+	if err != nil {
+		return err
+	}
+	query := `
+        UPDATE chapters
+        SET number = $1, title = $2, release_date = $3, manga_id = $4, version = version + 1
+        WHERE id = $5 AND version = $6
+        RETURNING version`
+	args := []interface{}{chapter.Number, chapter.Title, chapter.ReleaseDate, chapter.MangaID, chapter.ID, chapter.Version}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&chapter.Version)
+	if err != nil {
+		switch {
+		case isDuplicateChapter(err):
+			return ErrDuplicateChapter
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (m ChapterModel) Delete(ctx context.Context, id int64) error {
+	query := `
+        DELETE FROM chapters
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Reading is how far a member has read in a manga series, with what is left.
+// UnreadChapters only counts chapters released by today, or with no release
+// date.
+type Reading struct {
+	SeriesID       int64     `json:"series_id"`
+	Title          string    `json:"title"`
+	Status         string    `json:"status"`
+	LastChapter    float64   `json:"last_chapter"`
+	LatestChapter  float64   `json:"latest_chapter"`
+	UnreadChapters int       `json:"unread_chapters"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func ValidateLastChapter(v *validator.Validator, lastChapter float64) {
+	v.Check(lastChapter >= 0, "last_chapter", "must not be negative")
+	v.Check(lastChapter <= 999999.9, "last_chapter", "must not be more than 999999.9")
+	v.Check(validator.MaxDecimals(lastChapter, 1), "last_chapter", "must not have more than one decimal place")
+}
+
+type ReadingModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+const readingColumns = `
+            s.id AS series_id, s.title, s.status, p.last_chapter,
+            COALESCE((SELECT MAX(c.number) FROM chapters c WHERE c.series_id = s.id), 0) AS latest_chapter,
+            (SELECT count(*) FROM chapters c
+             WHERE c.series_id = s.id AND c.number > p.last_chapter AND (c.release_date IS NULL OR c.release_date <= CURRENT_DATE)) AS unread_chapters,
+            p.updated_at`
+
+func readingDest(reading *Reading) []interface{} {
+	return []interface{}{
+		&reading.SeriesID,
+		&reading.Title,
+		&reading.Status,
+		&reading.LastChapter,
+		&reading.LatestChapter,
+		&reading.UnreadChapters,
+		&reading.UpdatedAt,
+	}
+}
+
+// Set records the last chapter a member has read in a series. It returns
+// ErrRecordNotFound if there is no such series and ErrUnknownMember if there
+// is no such member.
+func (m ReadingModel) Set(ctx context.Context, memberID, seriesID int64, lastChapter float64) (*Reading, error) {
+	query := `
+        WITH p AS (
+            INSERT INTO reading_progress (member_id, series_id, last_chapter)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (member_id, series_id) DO UPDATE
+            SET last_chapter = EXCLUDED.last_chapter, updated_at = NOW()
+            RETURNING series_id, last_chapter, updated_at)
+        SELECT ` + readingColumns + `
+        FROM p JOIN manga_series s ON s.id = p.series_id`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	var reading Reading
+	err := m.DB.QueryRowContext(ctx, query, memberID, seriesID, lastChapter).Scan(readingDest(&reading)...)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Constraint == "reading_progress_series_id_fkey":
+			return nil, ErrRecordNotFound
+		case errors.As(err, &pqErr) && pqErr.Constraint == "reading_progress_member_id_fkey":
+			return nil, ErrUnknownMember
+		default:
+			return nil, err
+		}
+	}
+	return &reading, nil
+}
+
+// GetAllForMember lists the series a member is reading, those with unread
+// chapters first and then the most recently read.
+func (m ReadingModel) GetAllForMember(ctx context.Context, memberID int64) ([]*Reading, error) {
+	query := `
+        SELECT * FROM (
+            SELECT ` + readingColumns + `
+            FROM reading_progress p JOIN manga_series s ON s.id = p.series_id
+            WHERE p.member_id = $1) r
+        ORDER BY r.unread_chapters > 0 DESC, r.updated_at DESC, r.series_id`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Search)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, memberID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Reading{}
+	for rows.Next() {
+		var reading Reading
+		err := rows.Scan(readingDest(&reading)...)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, &reading)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Delete stops tracking a series for a member.
+func (m ReadingModel) Delete(ctx context.Context, memberID, seriesID int64) error {
+	query := `
+        DELETE FROM reading_progress
+        WHERE member_id = $1 AND series_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, memberID, seriesID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+type MockChapterModel struct{}
+
+func (m MockChapterModel) Insert(ctx context.Context, chapter *Chapter) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockChapterModel) Get(ctx context.Context, id int64) (*Chapter, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockChapterModel) GetAllForSeries(ctx context.Context, seriesID int64, filters Filters) ([]*Chapter, Metadata, error) {
+	return nil, Metadata{}, nil
+}
+
+func (m MockChapterModel) Update(ctx context.Context, chapter *Chapter) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockChapterModel) Delete(ctx context.Context, id int64) error {
+	// Мокируем действие...
+	return nil
+}
+
+type MockReadingModel struct{}
+
+func (m MockReadingModel) Set(ctx context.Context, memberID, seriesID int64, lastChapter float64) (*Reading, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockReadingModel) GetAllForMember(ctx context.Context, memberID int64) ([]*Reading, error) {
+	return nil, nil
+}
+
+func (m MockReadingModel) Delete(ctx context.Context, memberID, seriesID int64) error {
+	// Мокируем действие...
+	return nil
+}
@@ -0,0 +1,346 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"library-app/pkg/validator"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrDuplicateBarcode = errors.New("duplicate barcode")
+	ErrCopyOnHold       = errors.New("copy is set aside for a hold")
+	ErrCopyInUse        = errors.New("copy has loans on record")
+)
+
+const (
+	CopyAvailable = "available"
+	CopyOnLoan    = "on_loan"
+	CopyOnHold    = "on_hold"
+	CopyInTransit = "in_transit"
+	CopyMissing   = "missing"
+	CopyInRepair  = "in_repair"
+)
+
+var (
+	CopyConditions = []string{"new", "good", "fair", "poor", "damaged"}
+	CopyStatuses   = []string{CopyAvailable, CopyOnLoan, CopyOnHold, CopyInTransit, CopyMissing, CopyInRepair}
+)
+
+var BarcodeRX = regexp.MustCompile("^[A-Za-z0-9-]+$")
+
+// Copy is one physical item of a work on the shelves. WorkType is the Name
+// of the media type of the work. A copy belongs to its home branch and is at
+// its current branch, which only transfers and returns change.
+type Copy struct {
+	ID              int64     `json:"id"`
+	Barcode         string    `json:"barcode"`
+	WorkType        string    `json:"work_type"`
+	WorkID          int64     `json:"work_id"`
+	HomeBranchID    int64     `json:"home_branch_id"`
+	CurrentBranchID int64     `json:"current_branch_id"`
+	AcquiredOn      *Date     `json:"acquired_on,omitempty"`
+	Condition       string    `json:"condition"`
+	PriceCents      *int64    `json:"price_cents,omitempty"`
+	Status          string    `json:"status"`
+	CreatedAt       time.Time `json:"-"`
+	Version         int32     `json:"version"`
+}
+
+// Availability counts the copies of a work, and how many of them can be
+// lent out right now, in total and at each branch that has copies.
+type Availability struct {
+	Total     int                  `json:"total"`
+	Available int                  `json:"available"`
+	Branches  []BranchAvailability `json:"branches,omitempty"`
+}
+
+type BranchAvailability struct {
+	BranchID  int64  `json:"branch_id"`
+	Code      string `json:"code"`
+	Total     int    `json:"total"`
+	Available int    `json:"available"`
+}
+
+func ValidateBarcode(v *validator.Validator, barcode string) {
+	v.Check(barcode != "", "barcode", "must be provided")
+	v.Check(len(barcode) <= 64, "barcode", "must not be more than 64 bytes long")
+	v.Check(validator.Matches(barcode, BarcodeRX), "barcode", "must only contain letters, digits and dashes")
+}
+
+func ValidateCopy(v *validator.Validator, c *Copy) {
+	ValidateBarcode(v, c.Barcode)
+	v.Check(c.HomeBranchID > 0, "home_branch_id", "must be provided")
+	v.Check(validator.In(c.Condition, CopyConditions...), "condition", "must be one of new, good, fair, poor or damaged")
+	v.Check(validator.In(c.Status, CopyStatuses...), "status", "must be one of available, on_loan, on_hold, in_transit, missing or in_repair")
+	if c.AcquiredOn != nil {
+		v.Check(!c.AcquiredOn.After(time.Now()), "acquired_on", "must not be in the future")
+	}
+	if c.PriceCents != nil {
+		v.Check(*c.PriceCents >= 0, "price_cents", "must not be negative")
+	}
+}
+
+func isDuplicateBarcode(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Constraint == "copies_barcode_key"
+}
+
+// availabilityColumn returns a correlated subquery counting the copies of
+// each row of table as a JSON Availability.
+func availabilityColumn(workType, table string) string {
+	return fmt.Sprintf(`(
+            SELECT json_build_object('total', COUNT(*), 'available', COUNT(*) FILTER (WHERE cp.status = 'available'), 'branches', (
+                SELECT json_agg(json_build_object('branch_id', b.id, 'code', b.code, 'total', bc.total, 'available', bc.available) ORDER BY b.code)
+                FROM (
+                    SELECT cb.current_branch_id, COUNT(*) AS total, COUNT(*) FILTER (WHERE cb.status = 'available') AS available
+                    FROM copies cb
+                    WHERE cb.work_type = %[1]s AND cb.work_id = %[2]s.id
+                    GROUP BY cb.current_branch_id) bc
+                JOIN branches b ON b.id = bc.current_branch_id))
+            FROM copies cp
+            WHERE cp.work_type = %[1]s AND cp.work_id = %[2]s.id)`, pq.QuoteLiteral(workType), table)
+}
+
+type CopyModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+	works    []workTable
+}
+
+const copyColumns = "id, barcode, work_type, work_id, home_branch_id, current_branch_id, acquired_on, condition, price_cents, status, created_at, version"
+
+func copyDest(c *Copy) []interface{} {
+	return []interface{}{
+		&c.ID,
+		&c.Barcode,
+		&c.WorkType,
+		&c.WorkID,
+		&c.HomeBranchID,
+		&c.CurrentBranchID,
+		&c.AcquiredOn,
+		&c.Condition,
+		&c.PriceCents,
+		&c.Status,
+		&c.CreatedAt,
+		&c.Version,
+	}
+}
+
+// Insert adds a copy of the work named by c.WorkType and c.WorkID at its home
+// branch. It returns ErrRecordNotFound if there is no such work or it is in
+// the trash, and ErrUnknownBranch if there is no such branch.
+func (m CopyModel) Insert(ctx context.Context, c *Copy) error {
+	var table string
+	for _, work := range m.works {
+		if work.Type == c.WorkType {
+			table = work.Table
+		}
+	}
+	if table == "" {
+		return ErrRecordNotFound
+	}
+	query := fmt.Sprintf(`
+        INSERT INTO copies (barcode, work_type, work_id, home_branch_id, current_branch_id, acquired_on, condition, price_cents, status)
+        SELECT $1::text, $2::text, w.id, $8::bigint, $8::bigint, $4::date, $5::text, $6::bigint, $7::text
+        FROM %s w
+        WHERE w.id = $3 AND w.deleted_at IS NULL
+        RETURNING id, current_branch_id, created_at, version`, table)
+
+	args := []interface{}{c.Barcode, c.WorkType, c.WorkID, c.AcquiredOn, c.Condition, c.PriceCents, c.Status, c.HomeBranchID}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&c.ID, &c.CurrentBranchID, &c.CreatedAt, &c.Version)
+	if err != nil {
+		switch {
+		case isDuplicateBarcode(err):
+			return ErrDuplicateBarcode
+		case isBranchReference(err):
+			return ErrUnknownBranch
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m CopyModel) GetByBarcode(ctx context.Context, barcode string) (*Copy, error) {
+	query := `
+        SELECT ` + copyColumns + `
+        FROM copies
+        WHERE barcode = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var c Copy
+	err := m.DB.QueryRowContext(ctx, query, barcode).Scan(copyDest(&c)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// GetAllForWork lists the copies of a work by barcode.
+func (m CopyModel) GetAllForWork(ctx context.Context, workType string, workID int64) ([]*Copy, error) {
+	query := `
+        SELECT ` + copyColumns + `
+        FROM copies
+        WHERE work_type = $1 AND work_id = $2
+        ORDER BY barcode`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Search)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workType, workID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	copies := []*Copy{}
+	for rows.Next() {
+		var c Copy
+		err := rows.Scan(copyDest(&c)...)
+		if err != nil {
+			return nil, err
+		}
+		copies = append(copies, &c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+func (m CopyModel) Update(ctx context.Context, c *Copy) error {
+	query := `
+        UPDATE copies
+        SET barcode = $1, acquired_on = $2, condition = $3, price_cents = $4, status = $5, home_branch_id = $8, version = version + 1
+        WHERE id = $6 AND version = $7
+        RETURNING version`
+
+	args := []interface{}{
+		c.Barcode,
+		c.AcquiredOn,
+		c.Condition,
+		c.PriceCents,
+		c.Status,
+		c.ID,
+		c.Version,
+		c.HomeBranchID,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&c.Version)
+	if err != nil {
+		switch {
+		case isDuplicateBarcode(err):
+			return ErrDuplicateBarcode
+		case isBranchReference(err):
+			return ErrUnknownBranch
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a copy. It returns ErrCopyOnLoan or ErrCopyOnHold if the
+// copy is lent out or set aside for a hold, and ErrCopyInUse if it has ever
+// been lent out, as its loans are kept.
+func (m CopyModel) Delete(ctx context.Context, barcode string) error {
+	query := `
+        DELETE FROM copies
+        WHERE barcode = $1 AND status NOT IN ('on_loan', 'on_hold')`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, barcode)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return ErrCopyInUse
+		}
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		c, err := m.GetByBarcode(ctx, barcode)
+		if err != nil {
+			return err
+		}
+		if c.Status == CopyOnHold {
+			return ErrCopyOnHold
+		}
+		return ErrCopyOnLoan
+	}
+	return nil
+}
+
+// checkCirculation returns ErrWorkInCirculation if a copy of one of the
+// works is lent out, which keeps them out of the trash. Copies set aside for
+// holds are released by cancelHolds first.
+func checkCirculation(ctx context.Context, tx *sql.Tx, workType string, ids []int64) error {
+	query := `
+        SELECT EXISTS (
+            SELECT 1 FROM copies
+            WHERE work_type = $1 AND work_id = ANY($2) AND status = 'on_loan')`
+
+	var circulating bool
+	err := tx.QueryRowContext(ctx, query, workType, pq.Array(ids)).Scan(&circulating)
+	if err != nil {
+		return err
+	}
+	if circulating {
+		return ErrWorkInCirculation
+	}
+	return nil
+}
+
+type MockCopyModel struct{}
+
+func (m MockCopyModel) Insert(ctx context.Context, c *Copy) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockCopyModel) GetByBarcode(ctx context.Context, barcode string) (*Copy, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockCopyModel) GetAllForWork(ctx context.Context, workType string, workID int64) ([]*Copy, error) {
+	return nil, nil
+}
+
+func (m MockCopyModel) Update(ctx context.Context, c *Copy) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockCopyModel) Delete(ctx context.Context, barcode string) error {
+	// Мокируем действие...
+	return nil
+}
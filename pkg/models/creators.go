@@ -0,0 +1,111 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"library-app/pkg/validator"
+)
+
+var (
+	ErrUnknownAuthor = errors.New("unknown author")
+)
+
+var CreatorRoles = []string{"writer", "illustrator", "translator", "editor"}
+
+// Creator credits an author with a role on a work. Name is filled in from the
+// authors table when the work is read and is ignored on input.
+type Creator struct {
+	AuthorID int64  `json:"author_id"`
+	Name     string `json:"name,omitempty"`
+	Role     string `json:"role"`
+}
+
+func ValidateCreators(v *validator.Validator, creators []Creator) {
+	v.Check(creators != nil, "creators", "must be provided")
+	v.Check(len(creators) >= 1, "creators", "must contain at least 1 creator")
+	v.Check(len(creators) <= 20, "creators", "must not contain more than 20 creators")
+	seen := make(map[Creator]bool)
+	for _, creator := range creators {
+		v.Check(creator.AuthorID > 0, "creators", "must reference authors by a positive author_id")
+		v.Check(validator.In(creator.Role, CreatorRoles...), "creators", "role must be one of writer, illustrator, translator or editor")
+		key := Creator{AuthorID: creator.AuthorID, Role: creator.Role}
+		v.Check(!seen[key], "creators", "must not credit the same author with the same role twice")
+		seen[key] = true
+	}
+}
+
+// creatorsColumn returns a correlated subquery that aggregates the creators of
+// each row of table into a JSON array, in credit order.
+func creatorsColumn(workType, table string) string {
+	return fmt.Sprintf(`COALESCE((
+            SELECT json_agg(json_build_object('author_id', c.author_id, 'name', a.name, 'role', c.role) ORDER BY c.position)
+            FROM work_creators c JOIN authors a ON a.id = c.author_id
+            WHERE c.work_type = %s AND c.work_id = %s.id), '[]')`, pq.QuoteLiteral(workType), table)
+}
+
+// primaryCreatorColumn returns the name of the first credited creator, used
+// to sort works by author.
+func primaryCreatorColumn(workType, table string) string {
+	return fmt.Sprintf(`COALESCE((
+            SELECT a.name
+            FROM work_creators c JOIN authors a ON a.id = c.author_id
+            WHERE c.work_type = %s AND c.work_id = %s.id
+            ORDER BY c.position LIMIT 1), '')`, pq.QuoteLiteral(workType), table)
+}
+
+// saveCreators replaces the credits of a work with creators, filling in
+// their names as it goes. It returns ErrUnknownAuthor if one of them doesn't
+// exist or is in the trash.
+func saveCreators(ctx context.Context, tx *sql.Tx, workType string, workID int64, creators []Creator) error {
+	query := `
+        DELETE FROM work_creators
+        WHERE work_type = $1 AND work_id = $2`
+	_, err := tx.ExecContext(ctx, query, workType, workID)
+	if err != nil {
+		return err
+	}
+
+	// Authors in the trash can't be credited, so the insert only happens when
+	// the author row is there and not deleted.
+	query = `
+        INSERT INTO work_creators (work_type, work_id, author_id, role, position)
+        SELECT $1::text, $2::bigint, a.id, $4::text, $5::integer
+        FROM authors a
+        WHERE a.id = $3 AND a.deleted_at IS NULL
+        RETURNING (SELECT name FROM authors WHERE id = $3)`
+	for i := range creators {
+		creator := &creators[i]
+		err := tx.QueryRowContext(ctx, query, workType, workID, creator.AuthorID, creator.Role, i).Scan(&creator.Name)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrUnknownAuthor
+			default:
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// jsonColumn scans a json or jsonb column into dst.
+type jsonColumn struct {
+	dst interface{}
+}
+
+func (c jsonColumn) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, c.dst)
+	case string:
+		return json.Unmarshal([]byte(src), c.dst)
+	default:
+		return fmt.Errorf("cannot scan %T into a JSON column", src)
+	}
+}
@@ -1,16 +1,31 @@
 package models
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
 	"library-app/pkg/validator"
 	"math"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// Filters holds the paging and sorting parameters of a list request. Lists
+// are paged by page number unless Cursor is set, in which case the page
+// starts right after the row the cursor was issued for. SortTypes maps the
+// sort keys, without a "-", on numeric columns to "bigint" or "numeric", the
+// type their cursor values must parse as; other keys sort on text.
 type Filters struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	SortTypes    map[string]string
+	Cursor       string
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -20,6 +35,38 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	if f.Cursor != "" {
+		key, err := decodeCursor(f.Cursor)
+		v.Check(err == nil && key.Sort == f.Sort && f.validCursorValue(key.Value), "cursor", "must be a next_cursor value issued for the same sort")
+	}
+}
+
+var decimalRX = regexp.MustCompile(`^-?[0-9]{1,20}(\.[0-9]{1,20})?$`)
+
+// validCursorValue reports whether a decoded cursor value can be bound
+// against the sort column: NULL, or a string that parses as the type of the
+// column and, for text, holds no NUL byte. decodeCursor has already turned
+// numbers into strings.
+func (f Filters) validCursorValue(value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case string:
+		switch f.sortType() {
+		case "bigint":
+			_, err := strconv.ParseInt(value, 10, 64)
+			return err == nil
+		case "numeric":
+			return validator.Matches(value, decimalRX)
+		}
+		return !strings.ContainsRune(value, 0)
+	default:
+		return false
+	}
+}
+
+func (f Filters) sortType() string {
+	return f.SortTypes[strings.TrimPrefix(f.Sort, "-")]
 }
 
 func (f Filters) sortColumn() string {
@@ -38,6 +85,12 @@ func (f Filters) sortDirection() string {
 	return "ASC"
 }
 
+// orderBy returns the ORDER BY list of a query sorted on column. Rows with no
+// sort value come last whatever the direction, which paginate relies on.
+func (f Filters) orderBy(column string) string {
+	return fmt.Sprintf("%s %s NULLS LAST, id ASC", column, f.sortDirection())
+}
+
 func (f Filters) limit() int {
 	return f.PageSize
 }
@@ -46,11 +99,12 @@ func (f Filters) offset() int {
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -65,3 +119,215 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+// cursorKey is what an opaque cursor encodes: the sort it was issued for and
+// the sort value and id of the last row of the page before.
+type cursorKey struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v"`
+	ID    int64       `json:"i"`
+}
+
+func encodeCursor(key cursorKey) string {
+	js, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(cursor string) (cursorKey, error) {
+	var key cursorKey
+	js, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return key, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	err = dec.Decode(&key)
+	if err != nil {
+		return key, err
+	}
+	if n, ok := key.Value.(json.Number); ok {
+		key.Value = n.String()
+	}
+	return key, nil
+}
+
+// paginate adds what the page needs to a list query ordered by
+// f.orderBy(column) and returns the expressions for its count column, LIMIT
+// and OFFSET. In cursor mode the page seeks past the cursor instead of
+// counting and skipping rows, and one extra row is fetched to find out
+// whether there is a next page. A cursor issued for a row with no sort value
+// is already among the NULLs at the end, where only the id orders rows.
+func (f Filters) paginate(w *where, column string) (count, limit, offset string) {
+	if f.Cursor == "" {
+		return "count(*) OVER()", w.arg(f.limit()), w.arg(f.offset())
+	}
+	key, _ := decodeCursor(f.Cursor)
+	if key.Value == nil {
+		w.conditions = append(w.conditions, fmt.Sprintf("(%s IS NULL AND id > %s)", column, w.arg(key.ID)))
+		return "0", w.arg(f.limit() + 1), w.arg(0)
+	}
+	op := ">"
+	if f.sortDirection() == "DESC" {
+		op = "<"
+	}
+	value, id := w.arg(key.Value), w.arg(key.ID)
+	if t := f.sortType(); t != "" {
+		value += "::" + t
+	}
+	w.conditions = append(w.conditions, fmt.Sprintf("(%s %s %s OR (%s = %s AND id > %s) OR %s IS NULL)", column, op, value, column, value, id, column))
+	return "0", w.arg(f.limit() + 1), w.arg(0)
+}
+
+// pager follows the rows of a list query as they are scanned and works out
+// the Metadata of the page, including the cursor of the next one.
+type pager struct {
+	filters Filters
+	total   int
+	rows    int
+	more    bool
+	last    cursorKey
+}
+
+// add records a scanned row and reports whether it belongs on the page; it
+// doesn't when it is the extra row fetched in cursor mode.
+func (p *pager) add(sortKey interface{}, id int64) bool {
+	if p.filters.Cursor != "" && p.rows == p.filters.limit() {
+		p.more = true
+		return false
+	}
+	if b, ok := sortKey.([]byte); ok {
+		sortKey = string(b)
+	}
+	p.rows++
+	p.last = cursorKey{Sort: p.filters.Sort, Value: sortKey, ID: id}
+	return true
+}
+
+func (p *pager) metadata() Metadata {
+	if p.filters.Cursor != "" {
+		metadata := Metadata{PageSize: p.filters.PageSize}
+		if p.more {
+			metadata.NextCursor = encodeCursor(p.last)
+		}
+		return metadata
+	}
+	metadata := calculateMetadata(p.total, p.filters.Page, p.filters.PageSize)
+	if p.total > p.filters.offset()+p.rows {
+		metadata.NextCursor = encodeCursor(p.last)
+	}
+	return metadata
+}
+
+// WorkFilter narrows the list endpoints of every media type. Zero values
+// leave the corresponding column unrestricted, and all the set conditions
+// must hold at once. SeriesID only applies to media types with a
+// SeriesTable.
+type WorkFilter struct {
+	Title         string
+	AuthorID      int64
+	Role          string
+	YearMin       int32
+	YearMax       int32
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Genres        []string
+	GenresAny     []string
+	GenresNone    []string
+	BranchID      int64
+	SeriesID      int64
+}
+
+func ValidateWorkFilter(v *validator.Validator, f WorkFilter) {
+	v.Check(f.AuthorID >= 0, "author_id", "must be a positive integer")
+	v.Check(f.BranchID >= 0, "branch_id", "must be a positive integer")
+	v.Check(f.SeriesID >= 0, "series_id", "must be a positive integer")
+	v.Check(f.Role == "" || validator.In(f.Role, CreatorRoles...), "role", "must be one of writer, illustrator, translator or editor")
+	v.Check(f.YearMin == 0 || f.YearMin >= 1888, "year_min", "must be greater than 1888")
+	v.Check(f.YearMax == 0 || f.YearMax >= 1888, "year_max", "must be greater than 1888")
+	v.Check(f.YearMin == 0 || f.YearMax == 0 || f.YearMin <= f.YearMax, "year_max", "must not be less than year_min")
+	v.Check(f.CreatedAfter.IsZero() || f.CreatedBefore.IsZero() || f.CreatedAfter.Before(f.CreatedBefore), "created_before", "must be later than created_after")
+	for key, genres := range map[string][]string{"genres": f.Genres, "genres_any": f.GenresAny, "genres_none": f.GenresNone} {
+		v.Check(len(genres) <= 20, key, "must not contain more than 20 genres")
+		v.Check(!validator.In("", genres...), key, "must not contain empty values")
+	}
+	for _, genre := range f.GenresNone {
+		v.Check(!validator.In(genre, f.Genres...) && !validator.In(genre, f.GenresAny...), "genres_none", "must not repeat a genre that is also required")
+	}
+}
+
+// where collects the conditions of a WHERE clause together with their
+// positional arguments, so that filters can be combined without ever
+// interpolating user input into the SQL.
+type where struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg appends value to the arguments and returns its placeholder.
+func (w *where) arg(value interface{}) string {
+	w.args = append(w.args, value)
+	return fmt.Sprintf("$%d", len(w.args))
+}
+
+// add appends a condition whose single %s verb stands for the placeholder of
+// value.
+func (w *where) add(condition string, value interface{}) {
+	w.conditions = append(w.conditions, fmt.Sprintf(condition, w.arg(value)))
+}
+
+func (w *where) String() string {
+	if len(w.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(w.conditions, "\n        AND ")
+}
+
+// where builds the conditions of the filter for works of workType stored in
+// table.
+func (f WorkFilter) where(workType, table string) *where {
+	w := &where{}
+	if f.Title != "" {
+		w.add("to_tsvector('simple', title) @@ plainto_tsquery('simple', %s)", f.Title)
+	}
+	if f.AuthorID != 0 || f.Role != "" {
+		credit := []string{
+			"c.work_type = " + w.arg(workType),
+			"c.work_id = " + table + ".id",
+		}
+		if f.AuthorID != 0 {
+			credit = append(credit, "c.author_id = "+w.arg(f.AuthorID))
+		}
+		if f.Role != "" {
+			credit = append(credit, "c.role = "+w.arg(f.Role))
+		}
+		w.conditions = append(w.conditions, "EXISTS (SELECT 1 FROM work_creators c WHERE "+strings.Join(credit, " AND ")+")")
+	}
+	if f.YearMin != 0 {
+		w.add("year >= %s", f.YearMin)
+	}
+	if f.YearMax != 0 {
+		w.add("year <= %s", f.YearMax)
+	}
+	if !f.CreatedAfter.IsZero() {
+		w.add("created_at >= %s", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		w.add("created_at < %s", f.CreatedBefore)
+	}
+	if len(f.Genres) > 0 {
+		w.add("genres @> %s", pq.Array(f.Genres))
+	}
+	if len(f.GenresAny) > 0 {
+		w.add("genres && %s", pq.Array(f.GenresAny))
+	}
+	if len(f.GenresNone) > 0 {
+		w.add("NOT (genres && %s)", pq.Array(f.GenresNone))
+	}
+	if f.BranchID != 0 {
+		w.conditions = append(w.conditions, fmt.Sprintf("EXISTS (SELECT 1 FROM copies cb WHERE cb.work_type = %s AND cb.work_id = %s.id AND cb.current_branch_id = %s)", w.arg(workType), table, w.arg(f.BranchID)))
+	}
+	if f.SeriesID != 0 {
+		w.add("series_id = %s", f.SeriesID)
+	}
+	return w
+}
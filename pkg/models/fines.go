@@ -0,0 +1,335 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"library-app/pkg/validator"
+	"math"
+	"time"
+)
+
+var (
+	ErrFinesOwed   = errors.New("member owes too much in fines")
+	ErrOverpayment = errors.New("amount is more than the member owes")
+)
+
+const (
+	FineCharge  = "charge"
+	FinePayment = "payment"
+	FineWaiver  = "waiver"
+)
+
+// FinePolicy says what overdue loans cost. Rates gives the charge per day
+// overdue in cents by work type; work types missing from it are never
+// charged. The first GraceDays days overdue are free, and the charges for one
+// loan never add up to more than MaxCents. Members owing more than BlockCents
+// can't borrow. A zero MaxCents or BlockCents turns the cap or the block off.
+type FinePolicy struct {
+	Rates      map[string]int64
+	GraceDays  int
+	MaxCents   int64
+	BlockCents int64
+}
+
+// overdueDays counts the days a loan is overdue at t. Every started day past
+// the due date counts.
+func overdueDays(loan *Loan, t time.Time) int {
+	return int(math.Ceil(t.Sub(loan.DueAt).Hours() / 24))
+}
+
+// Fine works out the charge for a loan that is checked in or renewed at t,
+// before the cap.
+func (p FinePolicy) Fine(loan *Loan, t time.Time) int64 {
+	days := overdueDays(loan, t) - p.GraceDays
+	if days <= 0 {
+		return 0
+	}
+	return int64(days) * p.Rates[loan.WorkType]
+}
+
+// FineEntry is one line of the fines ledger of a member. Charges add to what
+// the member owes, payments and waivers take from it. Entries are never
+// changed once written. Actor is who recorded the entry.
+type FineEntry struct {
+	ID          int64     `json:"id"`
+	MemberID    int64     `json:"member_id"`
+	LoanID      *int64    `json:"loan_id,omitempty"`
+	Kind        string    `json:"kind"`
+	AmountCents int64     `json:"amount_cents"`
+	Note        string    `json:"note,omitempty"`
+	Actor       string    `json:"actor"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// FineBalance is what a member owes. AccruingCents is what their overdue
+// loans would be charged if they came back now, and isn't owed yet.
+type FineBalance struct {
+	MemberID      int64 `json:"member_id"`
+	BalanceCents  int64 `json:"balance_cents"`
+	AccruingCents int64 `json:"accruing_cents"`
+}
+
+// FineTotals adds up the entries matching a FineFilter by kind.
+type FineTotals struct {
+	ChargesCents  int64 `json:"charges_cents"`
+	PaymentsCents int64 `json:"payments_cents"`
+	WaiversCents  int64 `json:"waivers_cents"`
+}
+
+// FineFilter narrows the ledger down to one member, one kind of entry and a
+// time range. Zero values match everything.
+type FineFilter struct {
+	MemberID      int64
+	Kind          string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+func ValidateFineFilter(v *validator.Validator, f FineFilter) {
+	v.Check(f.MemberID >= 0, "member_id", "must be a positive integer")
+	if f.Kind != "" {
+		v.Check(validator.In(f.Kind, FineCharge, FinePayment, FineWaiver), "kind", "must be one of charge, payment or waiver")
+	}
+	v.Check(f.CreatedAfter.IsZero() || f.CreatedBefore.IsZero() || f.CreatedAfter.Before(f.CreatedBefore), "created_before", "must be later than created_after")
+}
+
+// ValidateFineEntry checks a payment or waiver. Waivers need a note saying
+// why.
+func ValidateFineEntry(v *validator.Validator, entry *FineEntry) {
+	v.Check(entry.AmountCents > 0, "amount_cents", "must be greater than zero")
+	v.Check(len(entry.Note) <= 500, "note", "must not be more than 500 bytes long")
+	if entry.Kind == FineWaiver {
+		v.Check(entry.Note != "", "note", "must be provided")
+	}
+}
+
+func (f FineFilter) where() *where {
+	w := &where{}
+	if f.MemberID != 0 {
+		w.add("member_id = %s", f.MemberID)
+	}
+	if f.Kind != "" {
+		w.add("kind = %s", f.Kind)
+	}
+	if !f.CreatedAfter.IsZero() {
+		w.add("created_at >= %s", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		w.add("created_at < %s", f.CreatedBefore)
+	}
+	return w
+}
+
+type FineModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+const fineColumns = "id, member_id, loan_id, kind, amount_cents, note, actor, created_at"
+
+func fineDest(entry *FineEntry) []interface{} {
+	return []interface{}{
+		&entry.ID,
+		&entry.MemberID,
+		&entry.LoanID,
+		&entry.Kind,
+		&entry.AmountCents,
+		&entry.Note,
+		&entry.Actor,
+		&entry.CreatedAt,
+	}
+}
+
+// Record adds a payment or waiver to the ledger of entry.MemberID. The member
+// is locked while the entry is written, and it returns ErrOverpayment if the
+// amount is more than they owe.
+func (m FineModel) Record(ctx context.Context, entry *FineEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, balance, err := lockMember(ctx, tx, entry.MemberID)
+	if err != nil {
+		return err
+	}
+	if entry.AmountCents > balance {
+		return ErrOverpayment
+	}
+	entry.Actor = ChangeFromContext(ctx).Actor
+	err = insertFine(ctx, tx, entry)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Balance works out what a member owes under policy. It returns
+// ErrRecordNotFound if there is no such member.
+func (m FineModel) Balance(ctx context.Context, memberID int64, policy FinePolicy) (*FineBalance, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	balance := &FineBalance{MemberID: memberID}
+	query := `
+        SELECT COALESCE(SUM(CASE WHEN f.kind = 'charge' THEN f.amount_cents ELSE -f.amount_cents END), 0)
+        FROM members m LEFT JOIN fines f ON f.member_id = m.id
+        WHERE m.id = $1
+        GROUP BY m.id`
+	err := m.DB.QueryRowContext(ctx, query, memberID).Scan(&balance.BalanceCents)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+        SELECT l.id, c.work_type, l.due_at, NOW(), (
+            SELECT COALESCE(SUM(f.amount_cents), 0)
+            FROM fines f
+            WHERE f.loan_id = l.id AND f.kind = 'charge')
+        FROM loans l JOIN copies c ON c.id = l.copy_id
+        WHERE l.member_id = $1 AND l.returned_at IS NULL AND l.due_at < NOW()`
+	rows, err := m.DB.QueryContext(ctx, query, memberID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var loan Loan
+		var now time.Time
+		var charged int64
+		err := rows.Scan(&loan.ID, &loan.WorkType, &loan.DueAt, &now, &charged)
+		if err != nil {
+			return nil, err
+		}
+		balance.AccruingCents += policy.capped(policy.Fine(&loan, now), charged)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return balance, nil
+}
+
+// GetAll lists the ledger entries matching filter, sorted by filters on
+// created_at, along with their totals by kind.
+func (m FineModel) GetAll(ctx context.Context, filter FineFilter, filters Filters) ([]*FineEntry, FineTotals, Metadata, error) {
+	w := filter.where()
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(),
+            COALESCE(SUM(amount_cents) FILTER (WHERE kind = 'charge') OVER(), 0),
+            COALESCE(SUM(amount_cents) FILTER (WHERE kind = 'payment') OVER(), 0),
+            COALESCE(SUM(amount_cents) FILTER (WHERE kind = 'waiver') OVER(), 0),
+            %s
+        FROM fines
+        %s
+        ORDER BY %s %s, id ASC
+        LIMIT %s OFFSET %s`, fineColumns, w, filters.sortColumn(), filters.sortDirection(), w.arg(filters.limit()), w.arg(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Search)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, w.args...)
+	if err != nil {
+		return nil, FineTotals{}, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var totals FineTotals
+	entries := []*FineEntry{}
+	for rows.Next() {
+		var entry FineEntry
+		dest := []interface{}{&totalRecords, &totals.ChargesCents, &totals.PaymentsCents, &totals.WaiversCents}
+		err := rows.Scan(append(dest, fineDest(&entry)...)...)
+		if err != nil {
+			return nil, FineTotals{}, Metadata{}, err
+		}
+		entries = append(entries, &entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, FineTotals{}, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entries, totals, metadata, nil
+}
+
+// capped trims a charge so that the charges for one loan, of which charged
+// cents have already been made, stay within the cap.
+func (p FinePolicy) capped(fine, charged int64) int64 {
+	if p.MaxCents > 0 && charged+fine > p.MaxCents {
+		fine = p.MaxCents - charged
+	}
+	if fine < 0 {
+		return 0
+	}
+	return fine
+}
+
+func insertFine(ctx context.Context, tx *sql.Tx, entry *FineEntry) error {
+	query := `
+        INSERT INTO fines (member_id, loan_id, kind, amount_cents, note, actor)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, created_at`
+	args := []interface{}{entry.MemberID, entry.LoanID, entry.Kind, entry.AmountCents, entry.Note, entry.Actor}
+	return tx.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// chargeFine charges the member of a loan for the days it has been overdue
+// at t under policy, within what is left of the cap for the loan. It
+// returns the amount charged.
+func chargeFine(ctx context.Context, tx *sql.Tx, loan *Loan, t time.Time, policy FinePolicy) (int64, error) {
+	fine := policy.Fine(loan, t)
+	if fine == 0 {
+		return 0, nil
+	}
+	var charged int64
+	query := `
+        SELECT COALESCE(SUM(amount_cents), 0)
+        FROM fines
+        WHERE loan_id = $1 AND kind = 'charge'`
+	err := tx.QueryRowContext(ctx, query, loan.ID).Scan(&charged)
+	if err != nil {
+		return 0, err
+	}
+	fine = policy.capped(fine, charged)
+	if fine == 0 {
+		return 0, nil
+	}
+	entry := &FineEntry{
+		MemberID:    loan.MemberID,
+		LoanID:      &loan.ID,
+		Kind:        FineCharge,
+		AmountCents: fine,
+		Note:        fmt.Sprintf("%s overdue by %d days", loan.Barcode, overdueDays(loan, t)),
+		Actor:       ChangeFromContext(ctx).Actor,
+	}
+	return fine, insertFine(ctx, tx, entry)
+}
+
+type MockFineModel struct{}
+
+func (m MockFineModel) Record(ctx context.Context, entry *FineEntry) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockFineModel) Balance(ctx context.Context, memberID int64, policy FinePolicy) (*FineBalance, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockFineModel) GetAll(ctx context.Context, filter FineFilter, filters Filters) ([]*FineEntry, FineTotals, Metadata, error) {
+	return nil, FineTotals{}, Metadata{}, nil
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"database/sql"
+)
+
+// Format is a media type of the catalogue as NewModels sees it, whatever its
+// Go type. NewModels builds the stores of every format it is given and hands
+// the trash, holds, loans, copies and authors the tables to look across, so
+// the formats passed in are the only list of media types there is.
+type Format interface {
+	workTable() workTable
+	stores(db *sql.DB, timeouts Timeouts) (interface{}, SeriesStore)
+	mocks() (interface{}, SeriesStore)
+}
+
+// WorkFormat is the Format of the media type Kind describes. Store, if set,
+// builds its store around its WorkModel, for media types with lookups of
+// their own, and Mock replaces MockWorkModel in NewMockModels.
+type WorkFormat[T any, PT Record[T]] struct {
+	Kind  Kind[T]
+	Store func(m WorkModel[T, PT]) WorkStore[T]
+	Mock  WorkStore[T]
+}
+
+func (f WorkFormat[T, PT]) workTable() workTable {
+	return f.Kind.workTable()
+}
+
+func (f WorkFormat[T, PT]) stores(db *sql.DB, timeouts Timeouts) (interface{}, SeriesStore) {
+	model := WorkModel[T, PT]{DB: db, Timeouts: timeouts, Kind: f.Kind}
+	var store WorkStore[T] = model
+	if f.Store != nil {
+		store = f.Store(model)
+	}
+	if f.Kind.SeriesTable == "" {
+		return store, nil
+	}
+	return store, SeriesModel{DB: db, Timeouts: timeouts, Table: f.Kind.SeriesTable}
+}
+
+func (f WorkFormat[T, PT]) mocks() (interface{}, SeriesStore) {
+	var store WorkStore[T] = MockWorkModel[T]{}
+	if f.Mock != nil {
+		store = f.Mock
+	}
+	if f.Kind.SeriesTable == "" {
+		return store, nil
+	}
+	return store, MockSeriesModel{}
+}
+
+// StoreOf returns the store of the media type kind describes.
+func StoreOf[T any](m Models, kind Kind[T]) WorkStore[T] {
+	return m.Works[kind.Name].(WorkStore[T])
+}
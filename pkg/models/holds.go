@@ -0,0 +1,538 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+var (
+	ErrDuplicateHold = errors.New("member already holds this title")
+	ErrHoldClosed    = errors.New("hold is no longer open")
+	ErrHoldsWaiting  = errors.New("other members are waiting for this title")
+)
+
+const (
+	HoldWaiting   = "waiting"
+	HoldReady     = "ready"
+	HoldFulfilled = "fulfilled"
+	HoldCancelled = "cancelled"
+	HoldExpired   = "expired"
+)
+
+// Hold queues a member for a work. Holds wait in the order they were placed
+// until a copy is set aside for them, then stay ready until the member picks
+// it up or the pickup window closes. Position is the place of a waiting hold
+// in the queue, starting at 1. Barcode is the copy set aside for a ready
+// hold. A hold with a PickupBranchID is only served by copies at that branch,
+// one without by copies at any branch.
+type Hold struct {
+	ID             int64      `json:"id"`
+	WorkType       string     `json:"work_type"`
+	WorkID         int64      `json:"work_id"`
+	MemberID       int64      `json:"member_id"`
+	PickupBranchID *int64     `json:"pickup_branch_id,omitempty"`
+	Status         string     `json:"status"`
+	Position       int        `json:"position,omitempty"`
+	Barcode        string     `json:"barcode,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReadyAt        *time.Time `json:"ready_at,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	Version        int32      `json:"version"`
+}
+
+func isDuplicateHold(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Constraint == "holds_open_member_idx"
+}
+
+type HoldModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+	works    []workTable
+}
+
+// holdColumns reads holds h with their queue position, for queries joining
+// the copy set aside for them as c.
+const holdColumns = `h.id, h.work_type, h.work_id, h.member_id, h.pickup_branch_id, h.status,
+            CASE WHEN h.status = 'waiting' THEN (
+                SELECT count(*) FROM holds q
+                WHERE q.work_type = h.work_type AND q.work_id = h.work_id AND q.status = 'waiting'
+                AND (q.created_at, q.id) <= (h.created_at, h.id))
+            ELSE 0 END,
+            COALESCE(c.barcode, ''), h.created_at, h.ready_at, h.expires_at, h.version`
+
+const holdTables = "holds h LEFT JOIN copies c ON c.id = h.copy_id"
+
+func holdDest(hold *Hold) []interface{} {
+	return []interface{}{
+		&hold.ID,
+		&hold.WorkType,
+		&hold.WorkID,
+		&hold.MemberID,
+		&hold.PickupBranchID,
+		&hold.Status,
+		&hold.Position,
+		&hold.Barcode,
+		&hold.CreatedAt,
+		&hold.ReadyAt,
+		&hold.ExpiresAt,
+		&hold.Version,
+	}
+}
+
+// Insert queues a member for the work named by hold.WorkType and
+// hold.WorkID. A copy that is on the shelf is set aside for the hold at once.
+// It returns ErrRecordNotFound if there is no such work or it is in the
+// trash, ErrUnknownBranch if there is no such pickup branch, and the rule
+// broken if the member may not borrow under policy.
+func (m HoldModel) Insert(ctx context.Context, hold *Hold, policy LoanPolicy) error {
+	var table string
+	for _, work := range m.works {
+		if work.Type == hold.WorkType {
+			table = work.Table
+		}
+	}
+	if table == "" {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+        SELECT id
+        FROM %s
+        WHERE id = $1 AND deleted_at IS NULL
+        FOR SHARE`, table)
+	err = tx.QueryRowContext(ctx, query, hold.WorkID).Scan(&hold.WorkID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	err = checkMember(ctx, tx, hold.MemberID, policy.Fines)
+	if err != nil {
+		return err
+	}
+	query = `
+        INSERT INTO holds (work_type, work_id, member_id, pickup_branch_id)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id`
+	err = tx.QueryRowContext(ctx, query, hold.WorkType, hold.WorkID, hold.MemberID, hold.PickupBranchID).Scan(&hold.ID)
+	if err != nil {
+		switch {
+		case isDuplicateHold(err):
+			return ErrDuplicateHold
+		case isBranchReference(err):
+			return ErrUnknownBranch
+		default:
+			return err
+		}
+	}
+	err = allocateCopies(ctx, tx, hold.WorkType, hold.WorkID, policy.PickupDays)
+	if err != nil {
+		return err
+	}
+	query = `
+        SELECT ` + holdColumns + `
+        FROM ` + holdTables + `
+        WHERE h.id = $1`
+	err = tx.QueryRowContext(ctx, query, hold.ID).Scan(holdDest(hold)...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m HoldModel) Get(ctx context.Context, id int64) (*Hold, error) {
+	query := `
+        SELECT ` + holdColumns + `
+        FROM ` + holdTables + `
+        WHERE h.id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var hold Hold
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(holdDest(&hold)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &hold, nil
+}
+
+// GetAllForWork lists the open holds on a work: the ready ones first, then
+// the queue in order.
+func (m HoldModel) GetAllForWork(ctx context.Context, workType string, workID int64) ([]*Hold, error) {
+	query := `
+        SELECT ` + holdColumns + `
+        FROM ` + holdTables + `
+        WHERE h.work_type = $1 AND h.work_id = $2 AND h.status IN ('waiting', 'ready')
+        ORDER BY h.status = 'waiting', h.created_at, h.id`
+
+	return m.list(ctx, query, workType, workID)
+}
+
+// GetAllForMember lists the open holds of a member, oldest first.
+func (m HoldModel) GetAllForMember(ctx context.Context, memberID int64) ([]*Hold, error) {
+	query := `
+        SELECT ` + holdColumns + `
+        FROM ` + holdTables + `
+        WHERE h.member_id = $1 AND h.status IN ('waiting', 'ready')
+        ORDER BY h.created_at, h.id`
+
+	return m.list(ctx, query, memberID)
+}
+
+func (m HoldModel) list(ctx context.Context, query string, args ...interface{}) ([]*Hold, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Search)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := []*Hold{}
+	for rows.Next() {
+		var hold Hold
+		err := rows.Scan(holdDest(&hold)...)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, &hold)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+// Cancel closes an open hold. The copy set aside for a ready hold goes to
+// the next hold in the queue.
+func (m HoldModel) Cancel(ctx context.Context, id int64, pickupDays int) (*Hold, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var hold Hold
+	query := `
+        SELECT ` + holdColumns + `
+        FROM ` + holdTables + `
+        WHERE h.id = $1
+        FOR UPDATE OF h`
+	err = tx.QueryRowContext(ctx, query, id).Scan(holdDest(&hold)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if hold.Status != HoldWaiting && hold.Status != HoldReady {
+		return nil, ErrHoldClosed
+	}
+	copyID, err := closeHold(ctx, tx, id, HoldCancelled)
+	if err != nil {
+		return nil, err
+	}
+	if copyID.Valid {
+		err = releaseCopy(ctx, tx, copyID.Int64, pickupDays)
+		if err != nil {
+			return nil, err
+		}
+	}
+	hold.Status = HoldCancelled
+	hold.Position = 0
+	hold.Version++
+	return &hold, tx.Commit()
+}
+
+// Process expires the ready holds whose pickup window has closed and sets
+// copies on the shelf aside for waiting holds, including the copies freed by
+// the expired holds. It returns how many holds expired.
+func (m HoldModel) Process(ctx context.Context, pickupDays int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        SELECT id
+        FROM holds
+        WHERE status = 'ready' AND expires_at < NOW()
+        FOR UPDATE SKIP LOCKED`
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		copyID, err := closeHold(ctx, tx, id, HoldExpired)
+		if err != nil {
+			return 0, err
+		}
+		if copyID.Valid {
+			err = releaseCopy(ctx, tx, copyID.Int64, pickupDays)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	err = allocateCopies(ctx, tx, "", 0, pickupDays)
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), tx.Commit()
+}
+
+// closeHold gives an open hold its final status and returns the copy that
+// was set aside for it, if any.
+func closeHold(ctx context.Context, tx *sql.Tx, id int64, status string) (sql.NullInt64, error) {
+	query := `
+        UPDATE holds
+        SET status = $2, version = version + 1
+        WHERE id = $1
+        RETURNING copy_id`
+	var copyID sql.NullInt64
+	err := tx.QueryRowContext(ctx, query, id, status).Scan(&copyID)
+	return copyID, err
+}
+
+// cancelHolds cancels the open holds on works that went to the trash. The
+// copies set aside for them go back on the shelf rather than to other holds,
+// as there are none left on the works.
+func cancelHolds(ctx context.Context, tx *sql.Tx, workType string, ids []int64) error {
+	query := `
+        UPDATE holds
+        SET status = 'cancelled', version = version + 1
+        WHERE work_type = $1 AND work_id = ANY($2) AND status IN ('waiting', 'ready')
+        RETURNING copy_id`
+	rows, err := tx.QueryContext(ctx, query, workType, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	var copyIDs []int64
+	for rows.Next() {
+		var copyID sql.NullInt64
+		err := rows.Scan(&copyID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if copyID.Valid {
+			copyIDs = append(copyIDs, copyID.Int64)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range copyIDs {
+		err := setCopyStatus(ctx, tx, id, CopyAvailable)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fulfilHold closes the open hold of the member of a new loan on the work
+// they borrowed. A different copy set aside for the hold goes to the next
+// hold in the queue.
+func fulfilHold(ctx context.Context, tx *sql.Tx, loan *Loan, pickupDays int) error {
+	query := `
+        UPDATE holds
+        SET status = 'fulfilled', version = version + 1
+        WHERE work_type = $1 AND work_id = $2 AND member_id = $3 AND status IN ('waiting', 'ready')
+        RETURNING copy_id`
+	var copyID sql.NullInt64
+	err := tx.QueryRowContext(ctx, query, loan.WorkType, loan.WorkID, loan.MemberID).Scan(&copyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil
+		default:
+			return err
+		}
+	}
+	if copyID.Valid && copyID.Int64 != loan.CopyID {
+		return releaseCopy(ctx, tx, copyID.Int64, pickupDays)
+	}
+	return nil
+}
+
+// releaseCopy puts a copy that came back into circulation aside for the next
+// hold waiting for its work at the branch the copy is at. If nobody is
+// waiting there the copy goes back on the shelf, and is sent to the branch of
+// the oldest waiting hold elsewhere that no other copy is on its way to.
+func releaseCopy(ctx context.Context, tx *sql.Tx, copyID int64, pickupDays int) error {
+	query := `
+        UPDATE holds
+        SET status = 'ready', copy_id = $1, ready_at = NOW(), expires_at = NOW() + make_interval(days => $2), version = version + 1
+        WHERE id = (
+            SELECT h.id
+            FROM holds h JOIN copies c ON c.work_type = h.work_type AND c.work_id = h.work_id
+            WHERE c.id = $1 AND h.status = 'waiting'
+            AND (h.pickup_branch_id IS NULL OR h.pickup_branch_id = c.current_branch_id)
+            ORDER BY h.created_at, h.id
+            LIMIT 1
+            FOR UPDATE OF h SKIP LOCKED)`
+	result, err := tx.ExecContext(ctx, query, copyID, pickupDays)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected > 0 {
+		err = cancelTransfers(ctx, tx, copyID)
+		if err != nil {
+			return err
+		}
+		return setCopyStatus(ctx, tx, copyID, CopyOnHold)
+	}
+	err = setCopyStatus(ctx, tx, copyID, CopyAvailable)
+	if err != nil {
+		return err
+	}
+
+	query = `
+        INSERT INTO transfers (copy_id, from_branch_id, to_branch_id)
+        SELECT c.id, c.current_branch_id, h.pickup_branch_id
+        FROM copies c JOIN holds h ON h.work_type = c.work_type AND h.work_id = c.work_id
+        WHERE c.id = $1 AND h.status = 'waiting' AND h.pickup_branch_id <> c.current_branch_id
+        AND (
+            SELECT count(*)
+            FROM transfers t JOIN copies tc ON tc.id = t.copy_id
+            WHERE tc.work_type = c.work_type AND tc.work_id = c.work_id
+            AND t.to_branch_id = h.pickup_branch_id AND t.status IN ('requested', 'in_transit')
+        ) < (
+            SELECT count(*)
+            FROM holds hb
+            WHERE hb.work_type = h.work_type AND hb.work_id = h.work_id
+            AND hb.pickup_branch_id = h.pickup_branch_id AND hb.status = 'waiting')
+        ORDER BY h.created_at, h.id
+        LIMIT 1
+        ON CONFLICT DO NOTHING`
+	_, err = tx.ExecContext(ctx, query, copyID)
+	return err
+}
+
+// allocateCopies sets the available copies of works with waiting holds
+// aside for them, or sends them to the branches the holds wait at. It looks
+// at one work if workType is set, or at every work otherwise.
+func allocateCopies(ctx context.Context, tx *sql.Tx, workType string, workID int64, pickupDays int) error {
+	query := `
+        SELECT c.id
+        FROM copies c
+        WHERE c.status = 'available'
+        AND ($1 = '' OR (c.work_type = $1 AND c.work_id = $2))
+        AND EXISTS (
+            SELECT 1 FROM holds h
+            WHERE h.work_type = c.work_type AND h.work_id = c.work_id AND h.status = 'waiting')
+        ORDER BY c.id
+        FOR UPDATE SKIP LOCKED`
+	rows, err := tx.QueryContext(ctx, query, workType, workID)
+	if err != nil {
+		return err
+	}
+	var copyIDs []int64
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		copyIDs = append(copyIDs, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range copyIDs {
+		err := releaseCopy(ctx, tx, id, pickupDays)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type MockHoldModel struct{}
+
+func (m MockHoldModel) Insert(ctx context.Context, hold *Hold, policy LoanPolicy) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockHoldModel) Get(ctx context.Context, id int64) (*Hold, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockHoldModel) GetAllForWork(ctx context.Context, workType string, workID int64) ([]*Hold, error) {
+	return nil, nil
+}
+
+func (m MockHoldModel) GetAllForMember(ctx context.Context, memberID int64) ([]*Hold, error) {
+	return nil, nil
+}
+
+func (m MockHoldModel) Cancel(ctx context.Context, id int64, pickupDays int) (*Hold, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockHoldModel) Process(ctx context.Context, pickupDays int) (int, error) {
+	// Мокируем действие...
+	return 0, nil
+}
@@ -0,0 +1,466 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"library-app/pkg/validator"
+	"time"
+)
+
+var (
+	ErrCopyUnavailable = errors.New("copy is not available")
+	ErrCopyOnLoan      = errors.New("copy is on loan")
+	ErrUnknownMember   = errors.New("unknown member")
+	ErrLoanLimit       = errors.New("member has reached the loan limit")
+	ErrRenewalLimit    = errors.New("loan has reached the renewal limit")
+	ErrLoanReturned    = errors.New("loan has been returned")
+)
+
+// Loan statuses accepted by LoanFilter. Overdue loans are active too.
+const (
+	LoanActive   = "active"
+	LoanOverdue  = "overdue"
+	LoanReturned = "returned"
+)
+
+// LoanPolicy holds the circulation rules. Days gives the loan period by work
+// type; work types missing from it can't be lent. PickupDays is how long a
+// copy returned for a hold stays set aside. Fines says what overdue loans
+// cost.
+type LoanPolicy struct {
+	Days        map[string]int
+	MaxActive   int
+	MaxRenewals int
+	PickupDays  int
+	Fines       FinePolicy
+}
+
+// Loan lends a copy to a member. Barcode, WorkType and WorkID are read from
+// the copy. FineCents is what the member was charged when the loan was
+// returned or renewed overdue; it is only set in the response to those.
+type Loan struct {
+	ID         int64      `json:"id"`
+	CopyID     int64      `json:"copy_id"`
+	Barcode    string     `json:"barcode"`
+	WorkType   string     `json:"work_type"`
+	WorkID     int64      `json:"work_id"`
+	MemberID   int64      `json:"member_id"`
+	LoanedAt   time.Time  `json:"loaned_at"`
+	DueAt      time.Time  `json:"due_at"`
+	ReturnedAt *time.Time `json:"returned_at,omitempty"`
+	Renewals   int        `json:"renewals"`
+	FineCents  int64      `json:"fine_cents,omitempty"`
+	Version    int32      `json:"version"`
+}
+
+// LoanFilter narrows a list of loans down to one member and one status. Zero
+// values match everything.
+type LoanFilter struct {
+	MemberID int64
+	Status   string
+}
+
+func ValidateLoanFilter(v *validator.Validator, f LoanFilter) {
+	v.Check(f.MemberID >= 0, "member_id", "must be a positive integer")
+	if f.Status != "" {
+		v.Check(validator.In(f.Status, LoanActive, LoanOverdue, LoanReturned), "status", "must be one of active, overdue or returned")
+	}
+}
+
+func (f LoanFilter) where() *where {
+	w := &where{}
+	if f.MemberID != 0 {
+		w.add("l.member_id = %s", f.MemberID)
+	}
+	switch f.Status {
+	case LoanActive:
+		w.conditions = append(w.conditions, "l.returned_at IS NULL")
+	case LoanOverdue:
+		w.conditions = append(w.conditions, "l.returned_at IS NULL AND l.due_at < NOW()")
+	case LoanReturned:
+		w.conditions = append(w.conditions, "l.returned_at IS NOT NULL")
+	}
+	return w
+}
+
+type LoanModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+	works    []workTable
+}
+
+const loanColumns = "l.id, l.copy_id, c.barcode, c.work_type, c.work_id, l.member_id, l.loaned_at, l.due_at, l.returned_at, l.renewals, l.version"
+
+func loanDest(loan *Loan) []interface{} {
+	return []interface{}{
+		&loan.ID,
+		&loan.CopyID,
+		&loan.Barcode,
+		&loan.WorkType,
+		&loan.WorkID,
+		&loan.MemberID,
+		&loan.LoanedAt,
+		&loan.DueAt,
+		&loan.ReturnedAt,
+		&loan.Renewals,
+		&loan.Version,
+	}
+}
+
+// Checkout lends the copy with the barcode to a member under policy. The copy
+// and the member are locked until the loan is saved, so two desks can't lend
+// the same copy or push a member over the loan limit together. Members owing
+// more in fines than the policy allows can't borrow. A copy set
+// aside for a hold can only be lent to the member who placed it. Lending a
+// member a copy fulfils their hold on the work, if they have one. Copies of
+// works in the trash can't be lent; the work is locked against being trashed
+// until the loan is saved.
+func (m LoanModel) Checkout(ctx context.Context, barcode string, memberID int64, policy LoanPolicy) (*Loan, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var c Copy
+	query := `
+        SELECT ` + copyColumns + `
+        FROM copies
+        WHERE barcode = $1
+        FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, barcode).Scan(copyDest(&c)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	days, ok := policy.Days[c.WorkType]
+	if !ok || (c.Status != CopyAvailable && c.Status != CopyOnHold) {
+		return nil, ErrCopyUnavailable
+	}
+	err = m.lockWork(ctx, tx, c.WorkType, c.WorkID)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status == CopyOnHold {
+		var holdID int64
+		query = `
+        SELECT id
+        FROM holds
+        WHERE copy_id = $1 AND member_id = $2 AND status = 'ready'
+        FOR UPDATE`
+		err = tx.QueryRowContext(ctx, query, c.ID, memberID).Scan(&holdID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return nil, ErrCopyUnavailable
+			default:
+				return nil, err
+			}
+		}
+	}
+
+	err = checkMember(ctx, tx, memberID, policy.Fines)
+	if err != nil {
+		return nil, err
+	}
+	var active int
+	query = `
+        SELECT count(*)
+        FROM loans
+        WHERE member_id = $1 AND returned_at IS NULL`
+	err = tx.QueryRowContext(ctx, query, memberID).Scan(&active)
+	if err != nil {
+		return nil, err
+	}
+	if active >= policy.MaxActive {
+		return nil, ErrLoanLimit
+	}
+
+	loan := &Loan{CopyID: c.ID, Barcode: c.Barcode, WorkType: c.WorkType, WorkID: c.WorkID, MemberID: memberID}
+	query = `
+        INSERT INTO loans (copy_id, member_id, due_at)
+        VALUES ($1, $2, NOW() + make_interval(days => $3))
+        RETURNING id, loaned_at, due_at, renewals, version`
+	err = tx.QueryRowContext(ctx, query, c.ID, memberID, days).Scan(&loan.ID, &loan.LoanedAt, &loan.DueAt, &loan.Renewals, &loan.Version)
+	if err != nil {
+		return nil, err
+	}
+	err = setCopyStatus(ctx, tx, c.ID, CopyOnLoan)
+	if err != nil {
+		return nil, err
+	}
+	err = cancelTransfers(ctx, tx, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = fulfilHold(ctx, tx, loan, policy.PickupDays)
+	if err != nil {
+		return nil, err
+	}
+	return loan, tx.Commit()
+}
+
+// lockWork checks that the work of a copy isn't in the trash and keeps it from
+// being trashed until tx ends. It returns ErrCopyUnavailable otherwise.
+func (m LoanModel) lockWork(ctx context.Context, tx *sql.Tx, workType string, workID int64) error {
+	var table string
+	for _, work := range m.works {
+		if work.Type == workType {
+			table = work.Table
+		}
+	}
+	if table == "" {
+		return ErrCopyUnavailable
+	}
+	query := fmt.Sprintf(`
+        SELECT id
+        FROM %s
+        WHERE id = $1 AND deleted_at IS NULL
+        FOR SHARE`, table)
+	err := tx.QueryRowContext(ctx, query, workID).Scan(&workID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrCopyUnavailable
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func setCopyStatus(ctx context.Context, tx *sql.Tx, copyID int64, status string) error {
+	query := `
+        UPDATE copies
+        SET status = $2, version = version + 1
+        WHERE id = $1 AND status <> $2`
+	_, err := tx.ExecContext(ctx, query, copyID, status)
+	return err
+}
+
+func (m LoanModel) Get(ctx context.Context, id int64) (*Loan, error) {
+	query := `
+        SELECT ` + loanColumns + `
+        FROM loans l JOIN copies c ON c.id = l.copy_id
+        WHERE l.id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var loan Loan
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(loanDest(&loan)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &loan, nil
+}
+
+// lock reads a loan inside tx and locks it until tx ends. Loans that have
+// been returned give ErrLoanReturned.
+func (m LoanModel) lock(ctx context.Context, tx *sql.Tx, id int64) (*Loan, error) {
+	query := `
+        SELECT ` + loanColumns + `
+        FROM loans l JOIN copies c ON c.id = l.copy_id
+        WHERE l.id = $1
+        FOR UPDATE OF l`
+
+	var loan Loan
+	err := tx.QueryRowContext(ctx, query, id).Scan(loanDest(&loan)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if loan.ReturnedAt != nil {
+		return nil, ErrLoanReturned
+	}
+	return &loan, nil
+}
+
+// Return checks a loan in and charges the member if it is overdue. A
+// branchID other than zero is the branch the copy was brought back to, which
+// becomes its current branch. The copy is then set aside for the next hold on
+// the work, if there is one, or goes back on the shelf. It returns
+// ErrUnknownBranch if there is no such branch.
+func (m LoanModel) Return(ctx context.Context, id int64, branchID int64, policy LoanPolicy) (*Loan, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	loan, err := m.lock(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+        UPDATE loans
+        SET returned_at = NOW(), version = version + 1
+        WHERE id = $1
+        RETURNING returned_at, version`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&loan.ReturnedAt, &loan.Version)
+	if err != nil {
+		return nil, err
+	}
+	loan.FineCents, err = chargeFine(ctx, tx, loan, *loan.ReturnedAt, policy.Fines)
+	if err != nil {
+		return nil, err
+	}
+	if branchID != 0 {
+		query = `
+        UPDATE copies
+        SET current_branch_id = $2, version = version + 1
+        WHERE id = $1`
+		_, err = tx.ExecContext(ctx, query, loan.CopyID, branchID)
+		if err != nil {
+			switch {
+			case isBranchReference(err):
+				return nil, ErrUnknownBranch
+			default:
+				return nil, err
+			}
+		}
+	}
+	err = releaseCopy(ctx, tx, loan.CopyID, policy.PickupDays)
+	if err != nil {
+		return nil, err
+	}
+	return loan, tx.Commit()
+}
+
+// Renew pushes the due date of a loan back by the loan period, counted from
+// the current due date or from now if the loan is overdue, in which case the
+// member is charged for the days so far. Loans of works other members are
+// waiting for can't be renewed.
+func (m LoanModel) Renew(ctx context.Context, id int64, policy LoanPolicy) (*Loan, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	loan, err := m.lock(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	days, ok := policy.Days[loan.WorkType]
+	if !ok || loan.Renewals >= policy.MaxRenewals {
+		return nil, ErrRenewalLimit
+	}
+	var waiting bool
+	query := `
+        SELECT EXISTS (
+            SELECT 1 FROM holds
+            WHERE work_type = $1 AND work_id = $2 AND status = 'waiting')`
+	err = tx.QueryRowContext(ctx, query, loan.WorkType, loan.WorkID).Scan(&waiting)
+	if err != nil {
+		return nil, err
+	}
+	if waiting {
+		return nil, ErrHoldsWaiting
+	}
+	err = checkMember(ctx, tx, loan.MemberID, policy.Fines)
+	if err != nil {
+		return nil, err
+	}
+	loan.FineCents, err = chargeFine(ctx, tx, loan, time.Now(), policy.Fines)
+	if err != nil {
+		return nil, err
+	}
+	query = `
+        UPDATE loans
+        SET due_at = GREATEST(due_at, NOW()) + make_interval(days => $2), renewals = renewals + 1, version = version + 1
+        WHERE id = $1
+        RETURNING due_at, renewals, version`
+	err = tx.QueryRowContext(ctx, query, id, days).Scan(&loan.DueAt, &loan.Renewals, &loan.Version)
+	if err != nil {
+		return nil, err
+	}
+	return loan, tx.Commit()
+}
+
+// GetAll lists loans, sorted by filters on loaned_at or due_at.
+func (m LoanModel) GetAll(ctx context.Context, filter LoanFilter, filters Filters) ([]*Loan, Metadata, error) {
+	w := filter.where()
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), %s
+        FROM loans l JOIN copies c ON c.id = l.copy_id
+        %s
+        ORDER BY l.%s %s, l.id ASC
+        LIMIT %s OFFSET %s`, loanColumns, w, filters.sortColumn(), filters.sortDirection(), w.arg(filters.limit()), w.arg(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Search)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, w.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	loans := []*Loan{}
+	for rows.Next() {
+		var loan Loan
+		err := rows.Scan(append([]interface{}{&totalRecords}, loanDest(&loan)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		loans = append(loans, &loan)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return loans, metadata, nil
+}
+
+type MockLoanModel struct{}
+
+func (m MockLoanModel) Checkout(ctx context.Context, barcode string, memberID int64, policy LoanPolicy) (*Loan, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockLoanModel) Get(ctx context.Context, id int64) (*Loan, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockLoanModel) Return(ctx context.Context, id int64, branchID int64, policy LoanPolicy) (*Loan, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockLoanModel) Renew(ctx context.Context, id int64, policy LoanPolicy) (*Loan, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockLoanModel) GetAll(ctx context.Context, filter LoanFilter, filters Filters) ([]*Loan, Metadata, error) {
+	return nil, Metadata{}, nil
+}
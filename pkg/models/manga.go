@@ -1,187 +1,100 @@
 package models
 
 import (
-	"context"
-	"database/sql"
-	"errors"
-	"fmt"
-	"github.com/lib/pq"
+	"bytes"
+	"encoding/json"
 	"library-app/pkg/validator"
-	"time"
 )
 
+// Manga is one volume. Volumes of a series name it with SeriesID and have a
+// VolumeNumber; a standalone manga has neither.
 type Manga struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	AuthorId  int64     `json:"author,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	Work
+	SeriesID     *int64 `json:"series_id,omitempty"`
+	VolumeNumber *int32 `json:"volume_number,omitempty"`
+	ReleaseDate  *Date  `json:"release_date,omitempty"`
 }
 
-func ValidateManga(v *validator.Validator, manga *Manga) {
-	v.Check(manga.Title != "", "title", "must be provided")
-	v.Check(len(manga.Title) <= 500, "title", "must not be more than 500 bytes long")
-	v.Check(manga.Year != 0, "year", "must be provided")
-	v.Check(manga.Year >= 1888, "year", "must be greater than 1888")
-	v.Check(manga.Year <= int32(time.Now().Year()), "year", "must not be in the future")
-	v.Check(manga.Genres != nil, "genres", "must be provided")
-	v.Check(len(manga.Genres) >= 1, "genres", "must contain at least 1 genre")
-	v.Check(len(manga.Genres) <= 5, "genres", "must not contain more than 5 genres")
-	v.Check(validator.Unique(manga.Genres), "genres", "must not contain duplicate values")
-}
-
-type MangaModel struct {
-	DB *sql.DB
-}
-
-func (m MangaModel) Insert(manga *Manga) error {
-
-	query := `
-        INSERT INTO mangas (title, year, author_id, genres)
-        VALUES ($1, $2, $3, $4)
-        RETURNING id, created_at, version`
-
-	args := []interface{}{manga.Title, manga.Year, manga.AuthorId, pq.Array(manga.Genres)}
-
-	return m.DB.QueryRow(query, args...).Scan(&manga.ID, &manga.CreatedAt, &manga.Version)
-}
-
-func (m MangaModel) Get(id int64) (*Manga, error) {
-	if id < 1 {
-		return nil, ErrRecordNotFound
-	}
-	query := `
-        SELECT id, created_at, title, year, author_id, genres, version
-        FROM mangas
-        WHERE id = $1`
-	var manga Manga
-	err := m.DB.QueryRow(query, id).Scan(
-		&manga.ID,
-		&manga.CreatedAt,
-		&manga.Title,
-		&manga.Year,
-		&manga.AuthorId,
-		pq.Array(&manga.Genres),
-		&manga.Version,
-	)
-	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrRecordNotFound
-		default:
-			return nil, err
-		}
-	}
-	return &manga, nil
-}
-
-func (m MangaModel) Update(manga *Manga) error {
-	query := `
-        UPDATE mangas
-        SET title = $1, year = $2, author_id = $3, genres = $4, version = version + 1
-        WHERE id = $5
-        RETURNING version`
-	args := []interface{}{
-		manga.Title,
-		manga.Year,
-		manga.AuthorId,
-		pq.Array(manga.Genres),
-		manga.ID,
+// manga has the fields of Manga without its JSON methods.
+type manga Manga
+
+// MarshalJSON adds the deprecated author key, the author_id of the first
+// creator, which manga had before they were credited through creators.
+func (m Manga) MarshalJSON() ([]byte, error) {
+	out := struct {
+		manga
+		Author *int64 `json:"author,omitempty"`
+	}{manga: manga(m)}
+	if len(m.Creators) > 0 {
+		out.Author = &m.Creators[0].AuthorID
 	}
-	return m.DB.QueryRow(query, args...).Scan(&manga.Version)
+	return json.Marshal(out)
 }
 
-func (m MangaModel) Delete(id int64) error {
-	if id < 1 {
-		return ErrRecordNotFound
-	}
-	query := `
-        DELETE FROM mangas
-        WHERE id = $1`
-	result, err := m.DB.Exec(query, id)
-	if err != nil {
-		return err
-	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+// UnmarshalJSON reads the deprecated author key as the author_id of the first
+// creator, or of a writer credit if creators is not given.
+func (m *Manga) UnmarshalJSON(data []byte) error {
+	in := struct {
+		*manga
+		Author *int64 `json:"author"`
+	}{manga: (*manga)(m)}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&in)
+	if err != nil || in.Author == nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	if len(m.Creators) == 0 {
+		m.Creators = []Creator{{AuthorID: *in.Author, Role: "writer"}}
+	} else {
+		m.Creators[0].AuthorID = *in.Author
 	}
 	return nil
 }
 
-func (m MangaModel) GetAll(title string, genres []string, filters Filters) ([]*Manga, Metadata, error) {
-	query := fmt.Sprintf(`
-        SELECT count(*) OVER(), id, created_at, title, year, author_id, genres, version
-        FROM mangas
-        WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '') 
-        AND (genres @> $2 OR $2 = '{}')     
-        ORDER BY %s %s, id ASC
-        LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	args := []interface{}{title, pq.Array(genres), filters.limit(), filters.offset()}
-
-	rows, err := m.DB.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, Metadata{}, err
-	}
-	defer rows.Close()
+// AliasKeys lists the keys that only repeat other fields.
+func (m Manga) AliasKeys() []string {
+	return []string{"author"}
+}
 
-	totalRecords := 0
-	mangas := []*Manga{}
-	for rows.Next() {
-		var manga Manga
-		err := rows.Scan(
-			&totalRecords,
-			&manga.ID,
-			&manga.CreatedAt,
-			&manga.Title,
-			&manga.Year,
-			&manga.AuthorId,
-			pq.Array(&manga.Genres),
-			&manga.Version,
-		)
-		if err != nil {
-			return nil, Metadata{}, err
-		}
-		mangas = append(mangas, &manga)
+func ValidateManga(v *validator.Validator, manga *Manga) {
+	ValidateWork(v, &manga.Work)
+	if manga.SeriesID != nil {
+		v.Check(*manga.SeriesID > 0, "series_id", "must be a positive integer")
+		v.Check(manga.VolumeNumber != nil, "volume_number", "must be provided for a volume of a series")
 	}
-	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
+	if manga.VolumeNumber != nil {
+		v.Check(manga.SeriesID != nil, "series_id", "must be provided for a numbered volume")
+		v.Check(*manga.VolumeNumber > 0, "volume_number", "must be greater than zero")
 	}
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
-
-	return mangas, metadata, nil
 }
 
-type MockMangaModel struct{}
-
-func (m MockMangaModel) Insert(manga *Manga) error {
-	// Мокируем действие...
-	return nil
+var MangaKind = Kind[Manga]{
+	Name:        "manga",
+	Plural:      "manga",
+	Table:       "mangas",
+	SeriesTable: "manga_series",
+	SeriesOrder: "volume_number",
+	Validate:    ValidateManga,
+	Fields: []Field[Manga]{
+		{
+			Column: "series_id",
+			Value:  func(manga *Manga) interface{} { return manga.SeriesID },
+			Scan:   func(manga *Manga) interface{} { return &manga.SeriesID },
+		},
+		{
+			Column:   "volume_number",
+			Sortable: true,
+			SortType: "bigint",
+			Value:    func(manga *Manga) interface{} { return manga.VolumeNumber },
+			Scan:     func(manga *Manga) interface{} { return &manga.VolumeNumber },
+		},
+		{
+			Column: "release_date",
+			Value:  func(manga *Manga) interface{} { return manga.ReleaseDate },
+			Scan:   func(manga *Manga) interface{} { return &manga.ReleaseDate },
+		},
+	},
 }
 
-func (m MockMangaModel) Get(id int64) (*Manga, error) {
-	// Мокируем действие...
-	return nil, nil
-}
-
-func (m MockMangaModel) Update(manga *Manga) error {
-	// Мокируем действие...
-	return nil
-}
-
-func (m MockMangaModel) Delete(id int64) error {
-	// Мокируем действие...
-	return nil
-}
-
-func (m MockMangaModel) GetAll(title string, genres []string, filters Filters) ([]*Manga, Metadata, error) {
-	return nil, Metadata{}, nil
-}
+var MangaFormat = WorkFormat[Manga, *Manga]{Kind: MangaKind}
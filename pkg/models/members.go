@@ -0,0 +1,467 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"library-app/pkg/validator"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrDuplicateCardNumber = errors.New("duplicate card number")
+	ErrDuplicateMemberUser = errors.New("user is already linked to a member")
+	ErrMemberInUse         = errors.New("member still has loans or fines")
+	ErrMemberBlocked       = errors.New("member is blocked")
+	ErrMembershipExpired   = errors.New("membership has expired")
+)
+
+const (
+	MembershipAdult   = "adult"
+	MembershipChild   = "child"
+	MembershipStudent = "student"
+)
+
+var MembershipTypes = []string{MembershipAdult, MembershipChild, MembershipStudent}
+
+var CardNumberRX = regexp.MustCompile("^[A-Za-z0-9-]+$")
+
+// Member is someone who borrows from the library, as opposed to the users who
+// sign in to the API. A member can be linked to the user account they sign in
+// with through UserID, which lets them see their own holds and fines.
+type Member struct {
+	ID             int64     `json:"id"`
+	CardNumber     string    `json:"card_number"`
+	Name           string    `json:"name"`
+	MembershipType string    `json:"membership_type"`
+	ExpiresOn      Date      `json:"expires_on"`
+	Email          string    `json:"email,omitempty"`
+	Phone          string    `json:"phone,omitempty"`
+	Address        string    `json:"address,omitempty"`
+	Blocked        bool      `json:"blocked"`
+	BlockedReason  string    `json:"blocked_reason,omitempty"`
+	UserID         *int64    `json:"user_id,omitempty"`
+	CreatedAt      time.Time `json:"-"`
+	Version        int32     `json:"version"`
+}
+
+// Standing says whether a member may borrow and place holds, with the rules
+// they break if not.
+type Standing struct {
+	CanBorrow bool     `json:"can_borrow"`
+	Reasons   []string `json:"reasons,omitempty"`
+}
+
+// Check applies the blocking rules to the member, who owes owed cents in
+// fines, at t: blocked members, expired memberships and members owing more
+// than policy allows can't borrow, renew or place holds. It returns the
+// rules broken, as errors.
+func (m *Member) Check(owed int64, policy FinePolicy, t time.Time) []error {
+	var errs []error
+	if m.Blocked {
+		errs = append(errs, ErrMemberBlocked)
+	}
+	if m.ExpiresOn.Before(NewDate(t).Time) {
+		errs = append(errs, ErrMembershipExpired)
+	}
+	if policy.BlockCents > 0 && owed > policy.BlockCents {
+		errs = append(errs, ErrFinesOwed)
+	}
+	return errs
+}
+
+func ValidateCardNumber(v *validator.Validator, cardNumber string) {
+	v.Check(cardNumber != "", "card_number", "must be provided")
+	v.Check(len(cardNumber) <= 32, "card_number", "must not be more than 32 bytes long")
+	v.Check(validator.Matches(cardNumber, CardNumberRX), "card_number", "must only contain letters, digits and dashes")
+}
+
+func ValidateMember(v *validator.Validator, member *Member) {
+	ValidateCardNumber(v, member.CardNumber)
+	v.Check(member.Name != "", "name", "must be provided")
+	v.Check(len(member.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(validator.In(member.MembershipType, MembershipTypes...), "membership_type", "must be one of adult, child or student")
+	v.Check(!member.ExpiresOn.IsZero(), "expires_on", "must be provided")
+	if member.Email != "" {
+		v.Check(validator.Matches(member.Email, validator.EmailRX), "email", "must be a valid email address")
+	}
+	v.Check(len(member.Phone) <= 32, "phone", "must not be more than 32 bytes long")
+	v.Check(len(member.Address) <= 500, "address", "must not be more than 500 bytes long")
+	v.Check(len(member.BlockedReason) <= 500, "blocked_reason", "must not be more than 500 bytes long")
+	if member.UserID != nil {
+		v.Check(*member.UserID > 0, "user_id", "must be a positive integer")
+	}
+}
+
+// MemberFilter finds members by card number, exactly, or by words of their
+// name. Zero values match everything.
+type MemberFilter struct {
+	CardNumber string
+	Name       string
+}
+
+func (f MemberFilter) where() *where {
+	w := &where{}
+	if f.CardNumber != "" {
+		w.add("card_number = %s", f.CardNumber)
+	}
+	if f.Name != "" {
+		w.add("to_tsvector('simple', name) @@ plainto_tsquery('simple', %s)", f.Name)
+	}
+	return w
+}
+
+func memberConstraintError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	switch pqErr.Constraint {
+	case "members_card_number_key":
+		return ErrDuplicateCardNumber
+	case "members_user_id_key":
+		return ErrDuplicateMemberUser
+	case "members_user_id_fkey":
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+type MemberModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+const memberColumns = "id, card_number, name, membership_type, expires_on, email, phone, address, blocked, blocked_reason, user_id, created_at, version"
+
+func memberDest(member *Member) []interface{} {
+	return []interface{}{
+		&member.ID,
+		&member.CardNumber,
+		&member.Name,
+		&member.MembershipType,
+		&member.ExpiresOn,
+		&member.Email,
+		&member.Phone,
+		&member.Address,
+		&member.Blocked,
+		&member.BlockedReason,
+		&member.UserID,
+		&member.CreatedAt,
+		&member.Version,
+	}
+}
+
+// Insert adds a member. It returns ErrDuplicateCardNumber or
+// ErrDuplicateMemberUser if the card number or user account is taken, and
+// ErrRecordNotFound if there is no such user.
+func (m MemberModel) Insert(ctx context.Context, member *Member) error {
+	query := `
+        INSERT INTO members (card_number, name, membership_type, expires_on, email, phone, address, blocked, blocked_reason, user_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+        RETURNING id, created_at, version`
+
+	args := []interface{}{
+		member.CardNumber,
+		member.Name,
+		member.MembershipType,
+		member.ExpiresOn,
+		member.Email,
+		member.Phone,
+		member.Address,
+		member.Blocked,
+		member.BlockedReason,
+		member.UserID,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&member.ID, &member.CreatedAt, &member.Version)
+	if err != nil {
+		return memberConstraintError(err)
+	}
+	return nil
+}
+
+func (m MemberModel) Get(ctx context.Context, id int64) (*Member, error) {
+	return m.get(ctx, "id", id)
+}
+
+// GetForUser returns the member linked to a user account.
+func (m MemberModel) GetForUser(ctx context.Context, userID int64) (*Member, error) {
+	return m.get(ctx, "user_id", userID)
+}
+
+func (m MemberModel) get(ctx context.Context, column string, value interface{}) (*Member, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM members
+        WHERE %s = $1`, memberColumns, column)
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var member Member
+	err := m.DB.QueryRowContext(ctx, query, value).Scan(memberDest(&member)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &member, nil
+}
+
+// GetAll lists the members matching filter, sorted by filters on name,
+// card_number or expires_on.
+func (m MemberModel) GetAll(ctx context.Context, filter MemberFilter, filters Filters) ([]*Member, Metadata, error) {
+	w := filter.where()
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), %s
+        FROM members
+        %s
+        ORDER BY %s %s, id ASC
+        LIMIT %s OFFSET %s`, memberColumns, w, filters.sortColumn(), filters.sortDirection(), w.arg(filters.limit()), w.arg(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Search)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, w.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	members := []*Member{}
+	for rows.Next() {
+		var member Member
+		err := rows.Scan(append([]interface{}{&totalRecords}, memberDest(&member)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		members = append(members, &member)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return members, metadata, nil
+}
+
+func (m MemberModel) Update(ctx context.Context, member *Member) error {
+	query := `
+        UPDATE members
+        SET card_number = $1, name = $2, membership_type = $3, expires_on = $4, email = $5, phone = $6, address = $7,
+            blocked = $8, blocked_reason = $9, user_id = $10, version = version + 1
+        WHERE id = $11 AND version = $12
+        RETURNING version`
+
+	args := []interface{}{
+		member.CardNumber,
+		member.Name,
+		member.MembershipType,
+		member.ExpiresOn,
+		member.Email,
+		member.Phone,
+		member.Address,
+		member.Blocked,
+		member.BlockedReason,
+		member.UserID,
+		member.ID,
+		member.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&member.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return memberConstraintError(err)
+		}
+	}
+	return nil
+}
+
+// Renew extends a membership by months, counted from its expiry date or
+// from today if it has already expired.
+func (m MemberModel) Renew(ctx context.Context, id int64, months int) (*Member, error) {
+	query := `
+        UPDATE members
+        SET expires_on = GREATEST(expires_on, CURRENT_DATE) + make_interval(months => $2), version = version + 1
+        WHERE id = $1
+        RETURNING ` + memberColumns
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	var member Member
+	err := m.DB.QueryRowContext(ctx, query, id, months).Scan(memberDest(&member)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &member, nil
+}
+
+// Standing applies the blocking rules to a member under policy. It returns
+// ErrRecordNotFound if there is no such member.
+func (m MemberModel) Standing(ctx context.Context, id int64, policy FinePolicy) (*Standing, error) {
+	query := `
+        SELECT ` + memberColumns + `, (
+            SELECT COALESCE(SUM(CASE WHEN f.kind = 'charge' THEN f.amount_cents ELSE -f.amount_cents END), 0)
+            FROM fines f
+            WHERE f.member_id = members.id), NOW()
+        FROM members
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var member Member
+	var owed int64
+	var now time.Time
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(append(memberDest(&member), &owed, &now)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	standing := &Standing{CanBorrow: true}
+	for _, err := range member.Check(owed, policy, now) {
+		standing.CanBorrow = false
+		standing.Reasons = append(standing.Reasons, err.Error())
+	}
+	return standing, nil
+}
+
+// Delete removes a member along with their holds. It returns ErrMemberInUse
+// while they have loans or fines on record.
+func (m MemberModel) Delete(ctx context.Context, id int64) error {
+	query := `
+        DELETE FROM members
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return ErrMemberInUse
+		}
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// lockMember reads a member inside tx and locks them until tx ends, with
+// what they owe in fines. It returns ErrUnknownMember if there is no such
+// member.
+func lockMember(ctx context.Context, tx *sql.Tx, id int64) (*Member, int64, error) {
+	query := `
+        SELECT ` + memberColumns + `
+        FROM members
+        WHERE id = $1
+        FOR UPDATE`
+	var member Member
+	err := tx.QueryRowContext(ctx, query, id).Scan(memberDest(&member)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, 0, ErrUnknownMember
+		default:
+			return nil, 0, err
+		}
+	}
+	var owed int64
+	query = `
+        SELECT COALESCE(SUM(CASE WHEN kind = 'charge' THEN amount_cents ELSE -amount_cents END), 0)
+        FROM fines
+        WHERE member_id = $1`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&owed)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &member, owed, nil
+}
+
+// checkMember locks a member inside tx and applies the blocking rules to
+// them under policy, returning the first rule they break.
+func checkMember(ctx context.Context, tx *sql.Tx, id int64, policy FinePolicy) error {
+	member, owed, err := lockMember(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if errs := member.Check(owed, policy, time.Now()); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+type MockMemberModel struct{}
+
+func (m MockMemberModel) Insert(ctx context.Context, member *Member) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockMemberModel) Get(ctx context.Context, id int64) (*Member, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockMemberModel) GetForUser(ctx context.Context, userID int64) (*Member, error) {
+	// Мокируем действие...
+	return nil, ErrRecordNotFound
+}
+
+func (m MockMemberModel) GetAll(ctx context.Context, filter MemberFilter, filters Filters) ([]*Member, Metadata, error) {
+	return nil, Metadata{}, nil
+}
+
+func (m MockMemberModel) Update(ctx context.Context, member *Member) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockMemberModel) Renew(ctx context.Context, id int64, months int) (*Member, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockMemberModel) Standing(ctx context.Context, id int64, policy FinePolicy) (*Standing, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockMemberModel) Delete(ctx context.Context, id int64) error {
+	// Мокируем действие...
+	return nil
+}
@@ -1,49 +1,208 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
-	ErrRecordNotFound = errors.New("record not found")
+	ErrRecordNotFound    = errors.New("record not found")
+	ErrEditConflict      = errors.New("edit conflict")
+	ErrAuthorHasWorks    = errors.New("author is still credited on works")
+	ErrWorkInCirculation = errors.New("work has copies on loan")
 )
 
+// Timeouts bounds how long each class of query may run. Read covers single
+// record lookups, Write covers inserts, updates and deletes, and Search covers
+// the list endpoints with their full-text and filter queries.
+type Timeouts struct {
+	Read   time.Duration
+	Write  time.Duration
+	Search time.Duration
+}
+
 type Models struct {
-	Books interface {
-		Insert(book *Book) error
-		Get(id int64) (*Book, error)
-		Update(book *Book) error
-		Delete(id int64) error
-		GetAll(title string, genres []string, filters Filters) ([]*Book, Metadata, error)
-	}
-	Mangas interface {
-		Insert(manga *Manga) error
-		Get(id int64) (*Manga, error)
-		Update(manga *Manga) error
-		Delete(id int64) error
-		GetAll(title string, genres []string, filters Filters) ([]*Manga, Metadata, error)
+	// Works holds the WorkStore of each format and Series the SeriesStore of
+	// each format that comes in series, keyed by kind name.
+	Works   map[string]interface{}
+	Series  map[string]SeriesStore
+	Volumes interface {
+		Next(ctx context.Context, seriesID, memberID int64) (*NextVolumes, error)
+	}
+	Chapters interface {
+		Insert(ctx context.Context, chapter *Chapter) error
+		Get(ctx context.Context, id int64) (*Chapter, error)
+		GetAllForSeries(ctx context.Context, seriesID int64, filters Filters) ([]*Chapter, Metadata, error)
+		Update(ctx context.Context, chapter *Chapter) error
+		Delete(ctx context.Context, id int64) error
+	}
+	Reading interface {
+		Set(ctx context.Context, memberID, seriesID int64, lastChapter float64) (*Reading, error)
+		GetAllForMember(ctx context.Context, memberID int64) ([]*Reading, error)
+		Delete(ctx context.Context, memberID, seriesID int64) error
 	}
 	Authors interface {
-		Insert(author *Author) error
-		Get(id int64) (*Author, error)
-		Update(author *Author) error
-		Delete(id int64) error
-		GetAll(name string, id int64, filters Filters) ([]*Author, error)
+		Insert(ctx context.Context, author *Author) error
+		Get(ctx context.Context, id int64) (*Author, error)
+		Update(ctx context.Context, author *Author) error
+		Delete(ctx context.Context, id int64, d AuthorDeletion) ([]CreditedWork, error)
+		Restore(ctx context.Context, id int64) (*Author, error)
+		GetAll(ctx context.Context, name string, filters Filters) ([]*Author, Metadata, error)
+	}
+	Branches interface {
+		Insert(ctx context.Context, branch *Branch) error
+		Get(ctx context.Context, id int64) (*Branch, error)
+		GetAll(ctx context.Context) ([]*Branch, error)
+		Update(ctx context.Context, branch *Branch) error
+		Delete(ctx context.Context, id int64) error
+	}
+	Copies interface {
+		Insert(ctx context.Context, c *Copy) error
+		GetByBarcode(ctx context.Context, barcode string) (*Copy, error)
+		GetAllForWork(ctx context.Context, workType string, workID int64) ([]*Copy, error)
+		Update(ctx context.Context, c *Copy) error
+		Delete(ctx context.Context, barcode string) error
+	}
+	Loans interface {
+		Checkout(ctx context.Context, barcode string, memberID int64, policy LoanPolicy) (*Loan, error)
+		Get(ctx context.Context, id int64) (*Loan, error)
+		Return(ctx context.Context, id int64, branchID int64, policy LoanPolicy) (*Loan, error)
+		Renew(ctx context.Context, id int64, policy LoanPolicy) (*Loan, error)
+		GetAll(ctx context.Context, filter LoanFilter, filters Filters) ([]*Loan, Metadata, error)
+	}
+	Holds interface {
+		Insert(ctx context.Context, hold *Hold, policy LoanPolicy) error
+		Get(ctx context.Context, id int64) (*Hold, error)
+		GetAllForWork(ctx context.Context, workType string, workID int64) ([]*Hold, error)
+		GetAllForMember(ctx context.Context, memberID int64) ([]*Hold, error)
+		Cancel(ctx context.Context, id int64, pickupDays int) (*Hold, error)
+		Process(ctx context.Context, pickupDays int) (int, error)
+	}
+	Fines interface {
+		Record(ctx context.Context, entry *FineEntry) error
+		Balance(ctx context.Context, memberID int64, policy FinePolicy) (*FineBalance, error)
+		GetAll(ctx context.Context, filter FineFilter, filters Filters) ([]*FineEntry, FineTotals, Metadata, error)
+	}
+	Members interface {
+		Insert(ctx context.Context, member *Member) error
+		Get(ctx context.Context, id int64) (*Member, error)
+		GetForUser(ctx context.Context, userID int64) (*Member, error)
+		GetAll(ctx context.Context, filter MemberFilter, filters Filters) ([]*Member, Metadata, error)
+		Update(ctx context.Context, member *Member) error
+		Renew(ctx context.Context, id int64, months int) (*Member, error)
+		Standing(ctx context.Context, id int64, policy FinePolicy) (*Standing, error)
+		Delete(ctx context.Context, id int64) error
+	}
+	Transfers interface {
+		Request(ctx context.Context, barcode string, toBranchID int64) (*Transfer, error)
+		Get(ctx context.Context, id int64) (*Transfer, error)
+		GetAll(ctx context.Context, filter TransferFilter, filters Filters) ([]*Transfer, Metadata, error)
+		Ship(ctx context.Context, id int64) (*Transfer, error)
+		Receive(ctx context.Context, id int64, pickupDays int) (*Transfer, error)
+		Cancel(ctx context.Context, id int64) (*Transfer, error)
+	}
+	Revisions interface {
+		Get(ctx context.Context, recordType string, id int64, revision int32) (*Revision, error)
+		GetAll(ctx context.Context, recordType string, id int64, filters Filters) ([]*Revision, Metadata, error)
+	}
+	Trash interface {
+		TrashTypes() []string
+		GetAll(ctx context.Context, recordType string, filters Filters) ([]*TrashedRecord, Metadata, error)
+		Purge(ctx context.Context, before time.Time) (int64, error)
+	}
+	Users interface {
+		Insert(ctx context.Context, user *User) error
+		GetByEmail(ctx context.Context, email string) (*User, error)
+		Update(ctx context.Context, user *User) error
+		GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error)
+		GetBySubject(ctx context.Context, subject string) (*User, error)
+		LinkSubject(ctx context.Context, user *User, subject string) error
+	}
+	Permissions interface {
+		GetAllForUser(ctx context.Context, userID int64, roles ...string) (Permissions, error)
+		AddRolesForUser(ctx context.Context, userID int64, roles ...string) error
+		SetRolesForUser(ctx context.Context, userID int64, roles []string) error
+	}
+	APIKeys interface {
+		Insert(ctx context.Context, key *APIKey) error
+		GetAll(ctx context.Context) ([]*APIKey, error)
+		GetForKey(ctx context.Context, plaintext string) (*APIKey, error)
+		Rotate(ctx context.Context, id int64) (*APIKey, error)
+		Revoke(ctx context.Context, id int64) error
+	}
+	Tokens interface {
+		New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+		Insert(ctx context.Context, token *Token) error
+		DeleteAllForUser(ctx context.Context, scope string, userID int64) error
 	}
 }
 
-func NewModels(db *sql.DB) Models {
+func NewModels(db *sql.DB, timeouts Timeouts, formats ...Format) Models {
+	works, stores, series := make([]workTable, 0, len(formats)), map[string]interface{}{}, map[string]SeriesStore{}
+	for _, format := range formats {
+		work := format.workTable()
+		works = append(works, work)
+		store, seriesStore := format.stores(db, timeouts)
+		stores[work.Type] = store
+		if seriesStore != nil {
+			series[work.Type] = seriesStore
+		}
+	}
 	return Models{
-		Books:   BookModel{DB: db},
-		Mangas:  MangaModel{DB: db},
-		Authors: AuthorModel{DB: db},
+		Works:       stores,
+		Series:      series,
+		Volumes:     VolumeModel{DB: db, Timeouts: timeouts},
+		Chapters:    ChapterModel{DB: db, Timeouts: timeouts},
+		Reading:     ReadingModel{DB: db, Timeouts: timeouts},
+		Authors:     AuthorModel{DB: db, Timeouts: timeouts, works: works},
+		Branches:    BranchModel{DB: db, Timeouts: timeouts},
+		Copies:      CopyModel{DB: db, Timeouts: timeouts, works: works},
+		Loans:       LoanModel{DB: db, Timeouts: timeouts, works: works},
+		Holds:       HoldModel{DB: db, Timeouts: timeouts, works: works},
+		Fines:       FineModel{DB: db, Timeouts: timeouts},
+		Members:     MemberModel{DB: db, Timeouts: timeouts},
+		Transfers:   TransferModel{DB: db, Timeouts: timeouts},
+		Revisions:   RevisionModel{DB: db, Timeouts: timeouts},
+		Trash:       TrashModel{DB: db, Timeouts: timeouts, works: works},
+		Users:       UserModel{DB: db, Timeouts: timeouts},
+		Permissions: PermissionModel{DB: db, Timeouts: timeouts},
+		APIKeys:     APIKeyModel{DB: db, Timeouts: timeouts},
+		Tokens:      TokenModel{DB: db, Timeouts: timeouts},
 	}
 }
 
-func NewMockModels() Models {
+func NewMockModels(formats ...Format) Models {
+	works, stores, series := make([]workTable, 0, len(formats)), map[string]interface{}{}, map[string]SeriesStore{}
+	for _, format := range formats {
+		work := format.workTable()
+		works = append(works, work)
+		store, seriesStore := format.mocks()
+		stores[work.Type] = store
+		if seriesStore != nil {
+			series[work.Type] = seriesStore
+		}
+	}
 	return Models{
-		Books:   MockBookModel{},
-		Authors: MockAuthorModel{},
+		Works:       stores,
+		Series:      series,
+		Volumes:     MockVolumeModel{},
+		Chapters:    MockChapterModel{},
+		Reading:     MockReadingModel{},
+		Authors:     MockAuthorModel{},
+		Branches:    MockBranchModel{},
+		Copies:      MockCopyModel{},
+		Loans:       MockLoanModel{},
+		Holds:       MockHoldModel{},
+		Fines:       MockFineModel{},
+		Members:     MockMemberModel{},
+		Transfers:   MockTransferModel{},
+		Revisions:   MockRevisionModel{},
+		Trash:       MockTrashModel{works: works},
+		Users:       MockUserModel{},
+		Permissions: MockPermissionModel{},
+		APIKeys:     MockAPIKeyModel{},
+		Tokens:      MockTokenModel{},
 	}
 }
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"library-app/pkg/validator"
+)
+
+// Roles are granted to users and bundle permissions: members can read the
+// catalogue, librarians can also change it, and admins can manage users too.
+var Roles = []string{"member", "librarian", "admin"}
+
+// DefaultRole is the role new users are registered with.
+const DefaultRole = "member"
+
+// Permissions holds permission codes such as "books:read" or "admin".
+type Permissions []string
+
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if code == p[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidateRoles(v *validator.Validator, roles []string) {
+	v.Check(roles != nil, "roles", "must be provided")
+	v.Check(validator.Unique(roles), "roles", "must not contain duplicate values")
+	for _, role := range roles {
+		v.Check(validator.In(role, Roles...), "roles", "must only contain member, librarian or admin")
+	}
+}
+
+type PermissionModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// GetAllForUser returns the permissions the user holds through their roles,
+// plus those of the named roles, which come from an identity provider.
+// Unknown role names are ignored.
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64, roles ...string) (Permissions, error) {
+	query := `
+        SELECT DISTINCT permissions.code
+        FROM permissions
+        INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+        INNER JOIN roles ON roles.id = roles_permissions.role_id
+        WHERE roles.id IN (SELECT role_id FROM users_roles WHERE user_id = $1)
+        OR roles.name = ANY($2)
+        ORDER BY permissions.code`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(roles))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := Permissions{}
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// AddRolesForUser grants roles to a user on top of the ones they hold.
+func (m PermissionModel) AddRolesForUser(ctx context.Context, userID int64, roles ...string) error {
+	query := `
+        INSERT INTO users_roles (user_id, role_id)
+        SELECT $1::bigint, roles.id FROM roles WHERE roles.name = ANY($2)
+        ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(roles))
+	return err
+}
+
+// SetRolesForUser replaces the roles of a user. It returns ErrRecordNotFound
+// if there is no such user.
+func (m PermissionModel) SetRolesForUser(ctx context.Context, userID int64, roles []string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        SELECT id
+        FROM users
+        WHERE id = $1
+        FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, userID).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	query = `
+        DELETE FROM users_roles
+        WHERE user_id = $1`
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	query = `
+        INSERT INTO users_roles (user_id, role_id)
+        SELECT $1::bigint, roles.id FROM roles WHERE roles.name = ANY($2)`
+	_, err = tx.ExecContext(ctx, query, userID, pq.Array(roles))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type MockPermissionModel struct{}
+
+func (m MockPermissionModel) GetAllForUser(ctx context.Context, userID int64, roles ...string) (Permissions, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockPermissionModel) AddRolesForUser(ctx context.Context, userID int64, roles ...string) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockPermissionModel) SetRolesForUser(ctx context.Context, userID int64, roles []string) error {
+	// Мокируем действие...
+	return nil
+}
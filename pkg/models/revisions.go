@@ -0,0 +1,261 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Revision actions. Deletes and restores only record who did them and why;
+// creates and updates also keep the values they wrote.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+// Change says who is making a write and why. Handlers put it in the request
+// context and the models record it with every revision they write.
+type Change struct {
+	Actor  string
+	Reason string
+}
+
+type changeContextKey struct{}
+
+func ContextWithChange(ctx context.Context, change Change) context.Context {
+	return context.WithValue(ctx, changeContextKey{}, change)
+}
+
+// ChangeFromContext returns the change stored in ctx, or an anonymous one if
+// there is none.
+func ChangeFromContext(ctx context.Context) Change {
+	change, ok := ctx.Value(changeContextKey{}).(Change)
+	if !ok || change.Actor == "" {
+		change.Actor = "anonymous"
+	}
+	return change
+}
+
+// Revision is one recorded write to a book, manga or author. Old and New hold
+// the values of the record before and after it, minus its id and version.
+type Revision struct {
+	Revision  int32                      `json:"revision"`
+	Action    string                     `json:"action"`
+	Actor     string                     `json:"actor"`
+	Reason    string                     `json:"reason,omitempty"`
+	CreatedAt time.Time                  `json:"created_at"`
+	Changes   []FieldChange              `json:"changes"`
+	Old       map[string]json.RawMessage `json:"-"`
+	New       map[string]json.RawMessage `json:"-"`
+}
+
+// FieldChange is the old and new value of one field in a revision. Either is
+// null when the field wasn't there before or after.
+type FieldChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old"`
+	New   json.RawMessage `json:"new"`
+}
+
+// diff lists the fields whose values differ between r.Old and r.New, in
+// field name order.
+func (r *Revision) diff() {
+	fields := make(map[string]bool)
+	for field := range r.Old {
+		fields[field] = true
+	}
+	for field := range r.New {
+		fields[field] = true
+	}
+	r.Changes = []FieldChange{}
+	for field := range fields {
+		if !jsonEqual(r.Old[field], r.New[field]) {
+			r.Changes = append(r.Changes, FieldChange{Field: field, Old: nullJSON(r.Old[field]), New: nullJSON(r.New[field])})
+		}
+	}
+	sort.Slice(r.Changes, func(i, j int) bool {
+		return r.Changes[i].Field < r.Changes[j].Field
+	})
+}
+
+// jsonEqual compares JSON values rather than their text, as jsonb doesn't
+// keep the formatting or key order they were written with.
+func jsonEqual(a, b json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func nullJSON(value json.RawMessage) json.RawMessage {
+	if value == nil {
+		return json.RawMessage("null")
+	}
+	return value
+}
+
+// Aliased is implemented by records whose JSON repeats some of their fields
+// under older keys. Revisions and patches leave those keys out.
+type Aliased interface {
+	AliasKeys() []string
+}
+
+// snapshot turns a record into the values stored with a revision.
+func snapshot(record interface{}) (map[string]json.RawMessage, error) {
+	if record == nil {
+		return nil, nil
+	}
+	if values, ok := record.(map[string]json.RawMessage); ok {
+		return values, nil
+	}
+	js, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]json.RawMessage
+	err = json.Unmarshal(js, &values)
+	if err != nil {
+		return nil, err
+	}
+	delete(values, "id")
+	delete(values, "version")
+	delete(values, "availability")
+	if aliased, ok := record.(Aliased); ok {
+		for _, key := range aliased.AliasKeys() {
+			delete(values, key)
+		}
+	}
+	return values, nil
+}
+
+// recordRevision adds the next revision of a record inside tx, which must
+// hold a lock on the record so that revision numbers can't collide. old and
+// new may be nil, a record or values already taken with snapshot.
+func recordRevision(ctx context.Context, tx *sql.Tx, recordType string, id int64, action string, old, new interface{}) error {
+	var values [2]interface{}
+	for i, record := range []interface{}{old, new} {
+		snap, err := snapshot(record)
+		if err != nil {
+			return err
+		}
+		if snap != nil {
+			js, err := json.Marshal(snap)
+			if err != nil {
+				return err
+			}
+			values[i] = string(js)
+		}
+	}
+	change := ChangeFromContext(ctx)
+	query := `
+        INSERT INTO revisions (record_type, record_id, revision, action, actor, reason, old_values, new_values)
+        SELECT $1, $2, COALESCE(MAX(revision), 0) + 1, $3::text, $4::text, $5::text, $6::jsonb, $7::jsonb
+        FROM revisions
+        WHERE record_type = $1 AND record_id = $2`
+	_, err := tx.ExecContext(ctx, query, recordType, id, action, change.Actor, change.Reason, values[0], values[1])
+	return err
+}
+
+type RevisionModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+func (m RevisionModel) Get(ctx context.Context, recordType string, id int64, revision int32) (*Revision, error) {
+	query := `
+        SELECT revision, action, actor, reason, created_at, old_values, new_values
+        FROM revisions
+        WHERE record_type = $1 AND record_id = $2 AND revision = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var r Revision
+	err := m.DB.QueryRowContext(ctx, query, recordType, id, revision).Scan(
+		&r.Revision,
+		&r.Action,
+		&r.Actor,
+		&r.Reason,
+		&r.CreatedAt,
+		jsonColumn{&r.Old},
+		jsonColumn{&r.New},
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	r.diff()
+	return &r, nil
+}
+
+// GetAll lists the revisions of a record, newest first unless filters say
+// otherwise.
+func (m RevisionModel) GetAll(ctx context.Context, recordType string, id int64, filters Filters) ([]*Revision, Metadata, error) {
+	query := `
+        SELECT count(*) OVER(), revision, action, actor, reason, created_at, old_values, new_values
+        FROM revisions
+        WHERE record_type = $1 AND record_id = $2
+        ORDER BY revision ` + filters.sortDirection() + `
+        LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Search)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, recordType, id, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*Revision{}
+	for rows.Next() {
+		var r Revision
+		err := rows.Scan(
+			&totalRecords,
+			&r.Revision,
+			&r.Action,
+			&r.Actor,
+			&r.Reason,
+			&r.CreatedAt,
+			jsonColumn{&r.Old},
+			jsonColumn{&r.New},
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		r.diff()
+		revisions = append(revisions, &r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return revisions, metadata, nil
+}
+
+type MockRevisionModel struct{}
+
+func (m MockRevisionModel) Get(ctx context.Context, recordType string, id int64, revision int32) (*Revision, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockRevisionModel) GetAll(ctx context.Context, recordType string, id int64, filters Filters) ([]*Revision, Metadata, error) {
+	return nil, Metadata{}, nil
+}
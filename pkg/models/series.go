@@ -0,0 +1,244 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"library-app/pkg/validator"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownSeries = errors.New("unknown series")
+	ErrSeriesInUse   = errors.New("series still has works")
+)
+
+var SeriesStatuses = []string{"ongoing", "completed", "hiatus"}
+
+// Series groups the works of one media type that belong together, such as
+// the volumes of a manga. Each media type keeps its series in its own table,
+// named by Kind.SeriesTable.
+type Series struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"-"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateSeries(v *validator.Validator, series *Series) {
+	v.Check(series.Title != "", "title", "must be provided")
+	v.Check(len(series.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(validator.In(series.Status, SeriesStatuses...), "status", "must be one of ongoing, completed or hiatus")
+}
+
+// SeriesFilter finds series by words of their title and by status. Zero
+// values match everything.
+type SeriesFilter struct {
+	Title  string
+	Status string
+}
+
+func ValidateSeriesFilter(v *validator.Validator, f SeriesFilter) {
+	v.Check(f.Status == "" || validator.In(f.Status, SeriesStatuses...), "status", "must be one of ongoing, completed or hiatus")
+}
+
+func (f SeriesFilter) where() *where {
+	w := &where{}
+	if f.Title != "" {
+		w.add("to_tsvector('simple', title) @@ plainto_tsquery('simple', %s)", f.Title)
+	}
+	if f.Status != "" {
+		w.add("status = %s", f.Status)
+	}
+	return w
+}
+
+// isSeriesReference reports whether err breaks the foreign key from works to
+// their series: a work naming a series that doesn't exist, or the deletion
+// of one that still has works.
+func isSeriesReference(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503" && strings.HasSuffix(pqErr.Constraint, "series_id_fkey")
+}
+
+// SeriesStore is the set of operations the handlers need for the series of
+// one media type.
+type SeriesStore interface {
+	Insert(ctx context.Context, series *Series) error
+	Get(ctx context.Context, id int64) (*Series, error)
+	GetAll(ctx context.Context, filter SeriesFilter, filters Filters) ([]*Series, Metadata, error)
+	Update(ctx context.Context, series *Series) error
+	Delete(ctx context.Context, id int64) error
+}
+
+// SeriesModel implements SeriesStore over the series table of one media
+// type.
+type SeriesModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+	Table    string
+}
+
+const seriesColumns = "id, title, status, created_at, version"
+
+func seriesDest(series *Series) []interface{} {
+	return []interface{}{
+		&series.ID,
+		&series.Title,
+		&series.Status,
+		&series.CreatedAt,
+		&series.Version,
+	}
+}
+
+func (m SeriesModel) Insert(ctx context.Context, series *Series) error {
+	query := fmt.Sprintf(`
+        INSERT INTO %s (title, status)
+        VALUES ($1, $2)
+        RETURNING id, created_at, version`, m.Table)
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, series.Title, series.Status).Scan(&series.ID, &series.CreatedAt, &series.Version)
+}
+
+func (m SeriesModel) Get(ctx context.Context, id int64) (*Series, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE id = $1`, seriesColumns, m.Table)
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var series Series
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(seriesDest(&series)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &series, nil
+}
+
+// GetAll lists the series matching filter, sorted by filters on id or title.
+func (m SeriesModel) GetAll(ctx context.Context, filter SeriesFilter, filters Filters) ([]*Series, Metadata, error) {
+	w := filter.where()
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), %s
+        FROM %s
+        %s
+        ORDER BY %s %s, id ASC
+        LIMIT %s OFFSET %s`, seriesColumns, m.Table, w, filters.sortColumn(), filters.sortDirection(), w.arg(filters.limit()), w.arg(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Search)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, w.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	list := []*Series{}
+	for rows.Next() {
+		var series Series
+		err := rows.Scan(append([]interface{}{&totalRecords}, seriesDest(&series)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		list = append(list, &series)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return list, metadata, nil
+}
+
+func (m SeriesModel) Update(ctx context.Context, series *Series) error {
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET title = $1, status = $2, version = version + 1
+        WHERE id = $3 AND version = $4
+        RETURNING version`, m.Table)
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, series.Title, series.Status, series.ID, series.Version).Scan(&series.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a series. It returns ErrSeriesInUse while any work, even
+// one in the trash, belongs to it.
+func (m SeriesModel) Delete(ctx context.Context, id int64) error {
+	query := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE id = $1`, m.Table)
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		switch {
+		case isSeriesReference(err):
+			return ErrSeriesInUse
+		default:
+			return err
+		}
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+type MockSeriesModel struct{}
+
+func (m MockSeriesModel) Insert(ctx context.Context, series *Series) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockSeriesModel) Get(ctx context.Context, id int64) (*Series, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockSeriesModel) GetAll(ctx context.Context, filter SeriesFilter, filters Filters) ([]*Series, Metadata, error) {
+	return nil, Metadata{}, nil
+}
+
+func (m MockSeriesModel) Update(ctx context.Context, series *Series) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockSeriesModel) Delete(ctx context.Context, id int64) error {
+	// Мокируем действие...
+	return nil
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"library-app/pkg/validator"
+	"time"
+)
+
+const (
+	ScopeActivation     = "activation"
+	ScopeAuthentication = "authentication"
+)
+
+// Token is a random secret handed to a user for one scope. Only its SHA-256
+// hash is stored, so the plaintext can't be recovered from the database.
+type Token struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserID    int64     `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
+}
+
+func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token := &Token{
+		UserID: userID,
+		Expiry: time.Now().Add(ttl),
+		Scope:  scope,
+	}
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+	return token, nil
+}
+
+func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
+	v.Check(tokenPlaintext != "", "token", "must be provided")
+	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
+}
+
+type TokenModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// New generates a token for the user and stores it.
+func (m TokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+func (m TokenModel) Insert(ctx context.Context, token *Token) error {
+	query := `
+        INSERT INTO tokens (hash, user_id, expiry, scope)
+        VALUES ($1, $2, $3, $4)`
+
+	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (m TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	query := `
+        DELETE FROM tokens
+        WHERE scope = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, scope, userID)
+	return err
+}
+
+type MockTokenModel struct{}
+
+func (m MockTokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockTokenModel) Insert(ctx context.Context, token *Token) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockTokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	// Мокируем действие...
+	return nil
+}
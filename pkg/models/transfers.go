@@ -0,0 +1,388 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"library-app/pkg/validator"
+	"time"
+)
+
+var (
+	ErrTransferOpen   = errors.New("copy is already being transferred")
+	ErrTransferStatus = errors.New("transfer is not at that stage")
+	ErrSameBranch     = errors.New("copy is already at that branch")
+)
+
+const (
+	TransferRequested = "requested"
+	TransferInTransit = "in_transit"
+	TransferReceived  = "received"
+	TransferCancelled = "cancelled"
+)
+
+// Transfer moves a copy from one branch to another. It is requested, then
+// shipped, when the copy goes in transit, and finally received at the other
+// branch, which becomes the current branch of the copy. Only requested
+// transfers can be cancelled. Barcode, WorkType and WorkID are read from the
+// copy.
+type Transfer struct {
+	ID           int64      `json:"id"`
+	CopyID       int64      `json:"copy_id"`
+	Barcode      string     `json:"barcode"`
+	WorkType     string     `json:"work_type"`
+	WorkID       int64      `json:"work_id"`
+	FromBranchID int64      `json:"from_branch_id"`
+	ToBranchID   int64      `json:"to_branch_id"`
+	Status       string     `json:"status"`
+	RequestedAt  time.Time  `json:"requested_at"`
+	ShippedAt    *time.Time `json:"shipped_at,omitempty"`
+	ReceivedAt   *time.Time `json:"received_at,omitempty"`
+	Version      int32      `json:"version"`
+}
+
+// TransferFilter narrows a list of transfers down to one status and the
+// branches they leave from or go to. Zero values match everything.
+type TransferFilter struct {
+	Status       string
+	FromBranchID int64
+	ToBranchID   int64
+}
+
+func ValidateTransferFilter(v *validator.Validator, f TransferFilter) {
+	if f.Status != "" {
+		v.Check(validator.In(f.Status, TransferRequested, TransferInTransit, TransferReceived, TransferCancelled), "status", "must be one of requested, in_transit, received or cancelled")
+	}
+	v.Check(f.FromBranchID >= 0, "from_branch_id", "must be a positive integer")
+	v.Check(f.ToBranchID >= 0, "to_branch_id", "must be a positive integer")
+}
+
+func (f TransferFilter) where() *where {
+	w := &where{}
+	if f.Status != "" {
+		w.add("t.status = %s", f.Status)
+	}
+	if f.FromBranchID != 0 {
+		w.add("t.from_branch_id = %s", f.FromBranchID)
+	}
+	if f.ToBranchID != 0 {
+		w.add("t.to_branch_id = %s", f.ToBranchID)
+	}
+	return w
+}
+
+func isOpenTransfer(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Constraint == "transfers_open_copy_idx"
+}
+
+type TransferModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+const transferColumns = "t.id, t.copy_id, c.barcode, c.work_type, c.work_id, t.from_branch_id, t.to_branch_id, t.status, t.requested_at, t.shipped_at, t.received_at, t.version"
+
+const transferTables = "transfers t JOIN copies c ON c.id = t.copy_id"
+
+func transferDest(transfer *Transfer) []interface{} {
+	return []interface{}{
+		&transfer.ID,
+		&transfer.CopyID,
+		&transfer.Barcode,
+		&transfer.WorkType,
+		&transfer.WorkID,
+		&transfer.FromBranchID,
+		&transfer.ToBranchID,
+		&transfer.Status,
+		&transfer.RequestedAt,
+		&transfer.ShippedAt,
+		&transfer.ReceivedAt,
+		&transfer.Version,
+	}
+}
+
+// Request asks for the copy with the barcode to be sent from its current
+// branch to another one. It returns ErrRecordNotFound if there is no such
+// copy, ErrUnknownBranch if there is no such branch, ErrSameBranch if the
+// copy is already there and ErrTransferOpen if it is already being sent
+// somewhere.
+func (m TransferModel) Request(ctx context.Context, barcode string, toBranchID int64) (*Transfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var c Copy
+	query := `
+        SELECT ` + copyColumns + `
+        FROM copies
+        WHERE barcode = $1
+        FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, barcode).Scan(copyDest(&c)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if c.CurrentBranchID == toBranchID {
+		return nil, ErrSameBranch
+	}
+
+	transfer := &Transfer{CopyID: c.ID, Barcode: c.Barcode, WorkType: c.WorkType, WorkID: c.WorkID, FromBranchID: c.CurrentBranchID, ToBranchID: toBranchID}
+	query = `
+        INSERT INTO transfers (copy_id, from_branch_id, to_branch_id)
+        VALUES ($1, $2, $3)
+        RETURNING id, status, requested_at, version`
+	err = tx.QueryRowContext(ctx, query, c.ID, c.CurrentBranchID, toBranchID).Scan(&transfer.ID, &transfer.Status, &transfer.RequestedAt, &transfer.Version)
+	if err != nil {
+		switch {
+		case isOpenTransfer(err):
+			return nil, ErrTransferOpen
+		case isBranchReference(err):
+			return nil, ErrUnknownBranch
+		default:
+			return nil, err
+		}
+	}
+	return transfer, tx.Commit()
+}
+
+func (m TransferModel) Get(ctx context.Context, id int64) (*Transfer, error) {
+	query := `
+        SELECT ` + transferColumns + `
+        FROM ` + transferTables + `
+        WHERE t.id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var transfer Transfer
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(transferDest(&transfer)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &transfer, nil
+}
+
+// GetAll lists transfers, sorted by filters on requested_at.
+func (m TransferModel) GetAll(ctx context.Context, filter TransferFilter, filters Filters) ([]*Transfer, Metadata, error) {
+	w := filter.where()
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), %s
+        FROM %s
+        %s
+        ORDER BY t.%s %s, t.id ASC
+        LIMIT %s OFFSET %s`, transferColumns, transferTables, w, filters.sortColumn(), filters.sortDirection(), w.arg(filters.limit()), w.arg(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Search)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, w.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	transfers := []*Transfer{}
+	for rows.Next() {
+		var transfer Transfer
+		err := rows.Scan(append([]interface{}{&totalRecords}, transferDest(&transfer)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		transfers = append(transfers, &transfer)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return transfers, metadata, nil
+}
+
+// lock reads a transfer inside tx and locks it and its copy until tx ends.
+// Transfers that aren't at the status given give ErrTransferStatus.
+func (m TransferModel) lock(ctx context.Context, tx *sql.Tx, id int64, status string) (*Transfer, string, error) {
+	query := `
+        SELECT ` + transferColumns + `, c.status
+        FROM ` + transferTables + `
+        WHERE t.id = $1
+        FOR UPDATE`
+
+	var transfer Transfer
+	var copyStatus string
+	err := tx.QueryRowContext(ctx, query, id).Scan(append(transferDest(&transfer), &copyStatus)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, "", ErrRecordNotFound
+		default:
+			return nil, "", err
+		}
+	}
+	if transfer.Status != status {
+		return nil, "", ErrTransferStatus
+	}
+	return &transfer, copyStatus, nil
+}
+
+// Ship sends the copy of a requested transfer on its way. Only copies on the
+// shelf can go; it returns ErrCopyUnavailable otherwise.
+func (m TransferModel) Ship(ctx context.Context, id int64) (*Transfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	transfer, copyStatus, err := m.lock(ctx, tx, id, TransferRequested)
+	if err != nil {
+		return nil, err
+	}
+	if copyStatus != CopyAvailable {
+		return nil, ErrCopyUnavailable
+	}
+	query := `
+        UPDATE transfers
+        SET status = 'in_transit', shipped_at = NOW(), version = version + 1
+        WHERE id = $1
+        RETURNING status, shipped_at, version`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&transfer.Status, &transfer.ShippedAt, &transfer.Version)
+	if err != nil {
+		return nil, err
+	}
+	err = setCopyStatus(ctx, tx, transfer.CopyID, CopyInTransit)
+	if err != nil {
+		return nil, err
+	}
+	return transfer, tx.Commit()
+}
+
+// Receive completes a transfer in transit. The copy is now at the branch it
+// was sent to, where it is set aside for the next hold waiting there or goes
+// on the shelf.
+func (m TransferModel) Receive(ctx context.Context, id int64, pickupDays int) (*Transfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	transfer, _, err := m.lock(ctx, tx, id, TransferInTransit)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+        UPDATE transfers
+        SET status = 'received', received_at = NOW(), version = version + 1
+        WHERE id = $1
+        RETURNING status, received_at, version`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&transfer.Status, &transfer.ReceivedAt, &transfer.Version)
+	if err != nil {
+		return nil, err
+	}
+	query = `
+        UPDATE copies
+        SET current_branch_id = $2, version = version + 1
+        WHERE id = $1`
+	_, err = tx.ExecContext(ctx, query, transfer.CopyID, transfer.ToBranchID)
+	if err != nil {
+		return nil, err
+	}
+	err = releaseCopy(ctx, tx, transfer.CopyID, pickupDays)
+	if err != nil {
+		return nil, err
+	}
+	return transfer, tx.Commit()
+}
+
+// Cancel drops a transfer that hasn't been shipped yet.
+func (m TransferModel) Cancel(ctx context.Context, id int64) (*Transfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	transfer, _, err := m.lock(ctx, tx, id, TransferRequested)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+        UPDATE transfers
+        SET status = 'cancelled', version = version + 1
+        WHERE id = $1
+        RETURNING status, version`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&transfer.Status, &transfer.Version)
+	if err != nil {
+		return nil, err
+	}
+	return transfer, tx.Commit()
+}
+
+// cancelTransfers drops the requested transfer of a copy that has just been
+// lent out or set aside where it is.
+func cancelTransfers(ctx context.Context, tx *sql.Tx, copyID int64) error {
+	query := `
+        UPDATE transfers
+        SET status = 'cancelled', version = version + 1
+        WHERE copy_id = $1 AND status = 'requested'`
+	_, err := tx.ExecContext(ctx, query, copyID)
+	return err
+}
+
+type MockTransferModel struct{}
+
+func (m MockTransferModel) Request(ctx context.Context, barcode string, toBranchID int64) (*Transfer, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockTransferModel) Get(ctx context.Context, id int64) (*Transfer, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockTransferModel) GetAll(ctx context.Context, filter TransferFilter, filters Filters) ([]*Transfer, Metadata, error) {
+	return nil, Metadata{}, nil
+}
+
+func (m MockTransferModel) Ship(ctx context.Context, id int64) (*Transfer, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockTransferModel) Receive(ctx context.Context, id int64, pickupDays int) (*Transfer, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockTransferModel) Cancel(ctx context.Context, id int64) (*Transfer, error) {
+	// Мокируем действие...
+	return nil, nil
+}
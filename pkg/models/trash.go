@@ -0,0 +1,182 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"library-app/pkg/validator"
+	"strings"
+	"time"
+)
+
+// TrashedRecord is a work or author sitting in the trash. Title holds the
+// name of authors.
+type TrashedRecord struct {
+	Type      string    `json:"type"`
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// TrashModel lists and purges deleted records across the work tables and
+// authors.
+type TrashModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+	works    []workTable
+}
+
+// TrashTypes returns the record types that can end up in the trash.
+func (m TrashModel) TrashTypes() []string {
+	return trashTypes(m.works)
+}
+
+func trashTypes(works []workTable) []string {
+	types := make([]string, 0, len(works)+1)
+	for _, work := range works {
+		types = append(types, work.Type)
+	}
+	return append(types, "author")
+}
+
+func ValidateTrashType(v *validator.Validator, recordType string, types []string) {
+	if recordType != "" {
+		v.Check(validator.In(recordType, types...), "type", "must be one of "+strings.Join(types, ", "))
+	}
+}
+
+// selects returns one SELECT per trashed table, restricted to recordType
+// when it is set.
+func (m TrashModel) selects(recordType string) []string {
+	var selects []string
+	for _, work := range m.works {
+		if recordType == "" || recordType == work.Type {
+			selects = append(selects, fmt.Sprintf(`
+            SELECT %s AS type, id, title, deleted_at FROM %s WHERE deleted_at IS NOT NULL`, pq.QuoteLiteral(work.Type), work.Table))
+		}
+	}
+	if recordType == "" || recordType == "author" {
+		selects = append(selects, `
+            SELECT 'author' AS type, id, name, deleted_at FROM authors WHERE deleted_at IS NOT NULL`)
+	}
+	return selects
+}
+
+// GetAll lists the trash, most recently deleted first unless filters say
+// otherwise. An empty recordType lists every type.
+func (m TrashModel) GetAll(ctx context.Context, recordType string, filters Filters) ([]*TrashedRecord, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), type, id, title, deleted_at
+        FROM (%s) trash
+        ORDER BY %s %s, type, id ASC
+        LIMIT $1 OFFSET $2`, strings.Join(m.selects(recordType), "\n            UNION ALL"), filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Search)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	records := []*TrashedRecord{}
+	for rows.Next() {
+		var record TrashedRecord
+		err := rows.Scan(
+			&totalRecords,
+			&record.Type,
+			&record.ID,
+			&record.Title,
+			&record.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		records = append(records, &record)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return records, metadata, nil
+}
+
+// Purge permanently deletes records that went to the trash before the given
+// time and returns how many rows went. Works take their credits with them.
+// Works that still have copies are kept until the copies are deleted, so that
+// purging never drops inventory or loan history. Authors are only purged once
+// no work credits them any more, which keeps restored works from losing
+// creators.
+func (m TrashModel) Purge(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var purged int64
+	for _, work := range m.works {
+		query := fmt.Sprintf(`
+        DELETE FROM work_creators c
+        USING %s w
+        WHERE c.work_type = $1 AND c.work_id = w.id AND w.deleted_at < $2
+        AND NOT EXISTS (SELECT 1 FROM copies cp WHERE cp.work_type = $1 AND cp.work_id = w.id)`, work.Table)
+		_, err := tx.ExecContext(ctx, query, work.Type, before)
+		if err != nil {
+			return 0, err
+		}
+		query = fmt.Sprintf(`
+        DELETE FROM %s w
+        WHERE w.deleted_at < $2
+        AND NOT EXISTS (SELECT 1 FROM copies cp WHERE cp.work_type = $1 AND cp.work_id = w.id)`, work.Table)
+		result, err := tx.ExecContext(ctx, query, work.Type, before)
+		if err != nil {
+			return 0, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		purged += rowsAffected
+	}
+
+	query := `
+        DELETE FROM authors a
+        WHERE a.deleted_at < $1
+        AND NOT EXISTS (SELECT 1 FROM work_creators c WHERE c.author_id = a.id)`
+	result, err := tx.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	purged += rowsAffected
+
+	return purged, tx.Commit()
+}
+
+type MockTrashModel struct {
+	works []workTable
+}
+
+func (m MockTrashModel) TrashTypes() []string {
+	return trashTypes(m.works)
+}
+
+func (m MockTrashModel) GetAll(ctx context.Context, recordType string, filters Filters) ([]*TrashedRecord, Metadata, error) {
+	return nil, Metadata{}, nil
+}
+
+func (m MockTrashModel) Purge(ctx context.Context, before time.Time) (int64, error) {
+	// Мокируем действие...
+	return 0, nil
+}
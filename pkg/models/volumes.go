@@ -0,0 +1,115 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// VolumeRef names a volume of a series by number, with the manga that is
+// that volume if the library has it in its catalogue.
+type VolumeRef struct {
+	VolumeNumber int32  `json:"volume_number"`
+	MangaID      *int64 `json:"manga_id,omitempty"`
+}
+
+// NextVolumes is what comes next in a series: the first volume a member
+// hasn't borrowed yet, and the first volume the library has no copy of.
+// Either is nil when there is none.
+type NextVolumes struct {
+	Unread  *VolumeRef `json:"unread"`
+	Unowned *VolumeRef `json:"unowned"`
+}
+
+type VolumeModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// Next looks up the next volumes of a manga series. Unread is only worked
+// out for a member, when memberID isn't zero. Volumes numbered past the last
+// one in the catalogue count as unowned until the series is completed. It
+// returns ErrRecordNotFound if there is no such series.
+func (m VolumeModel) Next(ctx context.Context, seriesID, memberID int64) (*NextVolumes, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var last int32
+	query := `
+        SELECT CASE WHEN s.status = 'completed' THEN 0 ELSE 1 END + COALESCE((
+            SELECT MAX(m.volume_number)
+            FROM mangas m
+            WHERE m.series_id = s.id AND m.deleted_at IS NULL), 0)
+        FROM manga_series s
+        WHERE s.id = $1`
+	err := m.DB.QueryRowContext(ctx, query, seriesID).Scan(&last)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	next := &NextVolumes{}
+	query = `
+        SELECT n, (
+            SELECT m.id
+            FROM mangas m
+            WHERE m.series_id = $1 AND m.volume_number = n AND m.deleted_at IS NULL
+            ORDER BY m.id
+            LIMIT 1)
+        FROM generate_series(1, $2::integer) AS n
+        WHERE NOT EXISTS (
+            SELECT 1
+            FROM mangas m JOIN copies c ON c.work_type = 'manga' AND c.work_id = m.id
+            WHERE m.series_id = $1 AND m.volume_number = n AND m.deleted_at IS NULL AND c.status <> 'missing')
+        ORDER BY n
+        LIMIT 1`
+	next.Unowned, err = m.volume(ctx, query, seriesID, last)
+	if err != nil {
+		return nil, err
+	}
+
+	if memberID != 0 {
+		query = `
+            SELECT m.volume_number, m.id
+            FROM mangas m
+            WHERE m.series_id = $1 AND m.deleted_at IS NULL AND NOT EXISTS (
+                SELECT 1
+                FROM loans l
+                JOIN copies c ON c.id = l.copy_id AND c.work_type = 'manga'
+                JOIN mangas r ON r.id = c.work_id
+                WHERE l.member_id = $2 AND r.series_id = $1 AND r.volume_number = m.volume_number)
+            ORDER BY m.volume_number, m.id
+            LIMIT 1`
+		next.Unread, err = m.volume(ctx, query, seriesID, memberID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
+
+// volume runs a query for at most one volume, giving nil if there is none.
+func (m VolumeModel) volume(ctx context.Context, query string, args ...interface{}) (*VolumeRef, error) {
+	var ref VolumeRef
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&ref.VolumeNumber, &ref.MangaID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	return &ref, nil
+}
+
+type MockVolumeModel struct{}
+
+func (m MockVolumeModel) Next(ctx context.Context, seriesID, memberID int64) (*NextVolumes, error) {
+	// Мокируем действие...
+	return nil, nil
+}
@@ -0,0 +1,501 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"library-app/pkg/validator"
+	"strings"
+	"time"
+)
+
+// Work holds the columns shared by every catalogue media type. Media types
+// embed it and may add their own fields on top through Kind.Fields.
+// Availability is counted from the copies of the work when it is read and
+// is ignored on input.
+type Work struct {
+	ID           int64         `json:"id"`
+	CreatedAt    time.Time     `json:"-"`
+	Title        string        `json:"title"`
+	Year         int32         `json:"year,omitempty"`
+	Creators     []Creator     `json:"creators"`
+	Genres       []string      `json:"genres,omitempty"`
+	Availability *Availability `json:"availability,omitempty"`
+	Version      int32         `json:"version"`
+}
+
+// Base gives generic code access to the shared columns of a media type.
+func (w *Work) Base() *Work {
+	return w
+}
+
+func ValidateWork(v *validator.Validator, work *Work) {
+	v.Check(work.Title != "", "title", "must be provided")
+	v.Check(len(work.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(work.Year != 0, "year", "must be provided")
+	v.Check(work.Year >= 1888, "year", "must be greater than 1888")
+	v.Check(work.Year <= int32(time.Now().Year()), "year", "must not be in the future")
+	v.Check(work.Genres != nil, "genres", "must be provided")
+	v.Check(len(work.Genres) >= 1, "genres", "must contain at least 1 genre")
+	v.Check(len(work.Genres) <= 5, "genres", "must not contain more than 5 genres")
+	v.Check(validator.Unique(work.Genres), "genres", "must not contain duplicate values")
+	ValidateCreators(v, work.Creators)
+}
+
+// Record is satisfied by pointers to media types that embed Work.
+type Record[T any] interface {
+	*T
+	Base() *Work
+}
+
+// Kind describes a media type stored through WorkModel. Name is the JSON
+// envelope key for a single record, Plural is both the URL segment and the
+// envelope key for lists. Media types whose works come in series name the
+// table of their series in SeriesTable, have a series_id column and order
+// the works of a series on the SeriesOrder sort key. Normalize, if set, tidies
+// a record from a request before it is validated; stored is the record it
+// replaces, or nil for a new one.
+type Kind[T any] struct {
+	Name        string
+	Plural      string
+	Table       string
+	SeriesTable string
+	SeriesOrder string
+	Normalize   func(record, stored *T)
+	Validate    func(v *validator.Validator, record *T)
+	Fields      []Field[T]
+}
+
+// Field maps a column that only one media type has onto its struct. Value
+// returns the argument written on insert and update, Scan the destination
+// read back from the database. SortType is the Filters.SortTypes entry of a
+// sortable numeric column.
+type Field[T any] struct {
+	Column   string
+	Sortable bool
+	SortType string
+	Value    func(record *T) interface{}
+	Scan     func(record *T) interface{}
+}
+
+// SortSafelist returns the values accepted by the sort query parameter.
+func (k Kind[T]) SortSafelist() []string {
+	keys := []string{"id", "title", "year", "author"}
+	for _, field := range k.Fields {
+		if field.Sortable {
+			keys = append(keys, field.Column)
+		}
+	}
+	safelist := append([]string{}, keys...)
+	for _, key := range keys {
+		safelist = append(safelist, "-"+key)
+	}
+	return safelist
+}
+
+// SortTypes returns the Filters.SortTypes of the sort keys.
+func (k Kind[T]) SortTypes() map[string]string {
+	types := map[string]string{"id": "bigint", "year": "bigint"}
+	for _, field := range k.Fields {
+		if field.Sortable && field.SortType != "" {
+			types[field.Column] = field.SortType
+		}
+	}
+	return types
+}
+
+func (k Kind[T]) sortColumn(filters Filters) string {
+	key := filters.sortColumn()
+	switch key {
+	case "id", "title", "year":
+		return key
+	case "author":
+		return primaryCreatorColumn(k.Name, k.Table)
+	}
+	for _, field := range k.Fields {
+		if field.Sortable && field.Column == key {
+			return field.Column
+		}
+	}
+	panic("unsafe sort parameter: " + filters.Sort)
+}
+
+// workTable names where the works of one media type live, for code that has
+// to look across every media type whatever its Go type.
+type workTable struct {
+	Type  string
+	Table string
+}
+
+func (k Kind[T]) workTable() workTable {
+	return workTable{Type: k.Name, Table: k.Table}
+}
+
+// WorkStore is the set of operations the handlers need for one media type.
+type WorkStore[T any] interface {
+	Insert(ctx context.Context, record *T) error
+	Get(ctx context.Context, id int64) (*T, error)
+	Update(ctx context.Context, record *T) error
+	Delete(ctx context.Context, id int64) error
+	Restore(ctx context.Context, id int64) (*T, error)
+	GetAll(ctx context.Context, filter WorkFilter, filters Filters) ([]*T, Metadata, error)
+}
+
+// WorkModel implements WorkStore for any media type described by a Kind.
+type WorkModel[T any, PT Record[T]] struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+	Kind     Kind[T]
+}
+
+// columns lists the writable columns in the order values() returns them.
+func (m WorkModel[T, PT]) columns() []string {
+	columns := []string{"title", "year", "genres"}
+	for _, field := range m.Kind.Fields {
+		columns = append(columns, field.Column)
+	}
+	return columns
+}
+
+func (m WorkModel[T, PT]) values(record PT) []interface{} {
+	work := record.Base()
+	values := []interface{}{work.Title, work.Year, pq.Array(work.Genres)}
+	for _, field := range m.Kind.Fields {
+		values = append(values, field.Value((*T)(record)))
+	}
+	return values
+}
+
+// selectColumns lists every column in the order dest() scans them.
+func (m WorkModel[T, PT]) selectColumns() string {
+	columns := []string{"id", "created_at", "title", "year", creatorsColumn(m.Kind.Name, m.Kind.Table), "genres", availabilityColumn(m.Kind.Name, m.Kind.Table), "version"}
+	for _, field := range m.Kind.Fields {
+		columns = append(columns, field.Column)
+	}
+	return strings.Join(columns, ", ")
+}
+
+func (m WorkModel[T, PT]) dest(record PT) []interface{} {
+	work := record.Base()
+	dest := []interface{}{
+		&work.ID,
+		&work.CreatedAt,
+		&work.Title,
+		&work.Year,
+		jsonColumn{&work.Creators},
+		pq.Array(&work.Genres),
+		jsonColumn{&work.Availability},
+		&work.Version,
+	}
+	for _, field := range m.Kind.Fields {
+		dest = append(dest, field.Scan((*T)(record)))
+	}
+	return dest
+}
+
+func placeholders(from, n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", from+i)
+	}
+	return strings.Join(params, ", ")
+}
+
+func (m WorkModel[T, PT]) Insert(ctx context.Context, record *T) error {
+	columns := m.columns()
+	query := fmt.Sprintf(`
+        INSERT INTO %s (%s)
+        VALUES (%s)
+        RETURNING id, created_at, version`, m.Kind.Table, strings.Join(columns, ", "), placeholders(1, len(columns)))
+
+	args := m.values(record)
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	work := PT(record).Base()
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&work.ID, &work.CreatedAt, &work.Version)
+	if err != nil {
+		switch {
+		case isSeriesReference(err):
+			return ErrUnknownSeries
+		case isDuplicateISBN(err):
+			return ErrDuplicateISBN
+		default:
+			return err
+		}
+	}
+	err = saveCreators(ctx, tx, m.Kind.Name, work.ID, work.Creators)
+	if err != nil {
+		return err
+	}
+	err = recordRevision(ctx, tx, m.Kind.Name, work.ID, ActionCreate, nil, record)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m WorkModel[T, PT]) Get(ctx context.Context, id int64) (*T, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	return m.get(ctx, "id = $1", id)
+}
+
+// get reads the work outside the trash that matches condition, which takes
+// arg as $1.
+func (m WorkModel[T, PT]) get(ctx context.Context, condition string, arg interface{}) (*T, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE %s AND deleted_at IS NULL`, m.selectColumns(), m.Kind.Table, condition)
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var record T
+	err := m.DB.QueryRowContext(ctx, query, arg).Scan(m.dest(&record)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &record, nil
+}
+
+func (m WorkModel[T, PT]) Update(ctx context.Context, record *T) error {
+	columns := m.columns()
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		assignments[i] = fmt.Sprintf("%s = $%d", column, i+1)
+	}
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET %s, version = version + 1
+        WHERE id = $%d AND version = $%d AND deleted_at IS NULL
+        RETURNING version`, m.Kind.Table, strings.Join(assignments, ", "), len(columns)+1, len(columns)+2)
+
+	work := PT(record).Base()
+	args := append(m.values(record), work.ID, work.Version)
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	old, err := m.lock(ctx, tx, work.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&work.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case isSeriesReference(err):
+			return ErrUnknownSeries
+		case isDuplicateISBN(err):
+			return ErrDuplicateISBN
+		default:
+			return err
+		}
+	}
+	err = saveCreators(ctx, tx, m.Kind.Name, work.ID, work.Creators)
+	if err != nil {
+		return err
+	}
+	err = recordRevision(ctx, tx, m.Kind.Name, work.ID, ActionUpdate, old, record)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lock reads a work that isn't in the trash inside tx and locks its row until
+// tx ends.
+func (m WorkModel[T, PT]) lock(ctx context.Context, tx *sql.Tx, id int64) (*T, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE id = $1 AND deleted_at IS NULL
+        FOR UPDATE`, m.selectColumns(), m.Kind.Table)
+
+	var record T
+	err := tx.QueryRowContext(ctx, query, id).Scan(m.dest(&record)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &record, nil
+}
+
+// Delete moves a work to the trash. Its credits are kept so that Restore can
+// bring it back as it was; they go when the trash is purged. Open holds on the
+// work are cancelled. It returns ErrWorkInCirculation while copies of the work
+// are on loan.
+func (m WorkModel[T, PT]) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET deleted_at = NOW(), version = version + 1
+        WHERE id = $1 AND deleted_at IS NULL`, m.Kind.Table)
+
+	return m.trash(ctx, query, id, ActionDelete)
+}
+
+// Restore takes a work back out of the trash.
+func (m WorkModel[T, PT]) Restore(ctx context.Context, id int64) (*T, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET deleted_at = NULL, version = version + 1
+        WHERE id = $1 AND deleted_at IS NOT NULL`, m.Kind.Table)
+
+	err := m.trash(ctx, query, id, ActionRestore)
+	if err != nil {
+		return nil, err
+	}
+	return m.Get(ctx, id)
+}
+
+// trash runs the query moving a work into or out of the trash and records it
+// as action.
+func (m WorkModel[T, PT]) trash(ctx context.Context, query string, id int64, action string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	if action == ActionDelete {
+		err = cancelHolds(ctx, tx, m.Kind.Name, []int64{id})
+		if err != nil {
+			return err
+		}
+		err = checkCirculation(ctx, tx, m.Kind.Name, []int64{id})
+		if err != nil {
+			return err
+		}
+	}
+	err = recordRevision(ctx, tx, m.Kind.Name, id, action, nil, nil)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m WorkModel[T, PT]) GetAll(ctx context.Context, filter WorkFilter, filters Filters) ([]*T, Metadata, error) {
+	where := filter.where(m.Kind.Name, m.Kind.Table)
+	where.conditions = append(where.conditions, "deleted_at IS NULL")
+	column := m.Kind.sortColumn(filters)
+	count, limit, offset := filters.paginate(where, column)
+	query := fmt.Sprintf(`
+        SELECT %s, %s, %s
+        FROM %s
+        %s
+        ORDER BY %s
+        LIMIT %s OFFSET %s`, count, m.selectColumns(), column, m.Kind.Table, where, filters.orderBy(column), limit, offset)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Search)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	p := pager{filters: filters}
+	records := []*T{}
+	for rows.Next() {
+		var record T
+		var sortKey interface{}
+		dest := append([]interface{}{&p.total}, m.dest(&record)...)
+		err := rows.Scan(append(dest, &sortKey)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		if !p.add(sortKey, PT(&record).Base().ID) {
+			break
+		}
+		records = append(records, &record)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return records, p.metadata(), nil
+}
+
+type MockWorkModel[T any] struct{}
+
+func (m MockWorkModel[T]) Insert(ctx context.Context, record *T) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockWorkModel[T]) Get(ctx context.Context, id int64) (*T, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockWorkModel[T]) Update(ctx context.Context, record *T) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockWorkModel[T]) Delete(ctx context.Context, id int64) error {
+	// Мокируем действие...
+	return nil
+}
+
+func (m MockWorkModel[T]) Restore(ctx context.Context, id int64) (*T, error) {
+	// Мокируем действие...
+	return nil, nil
+}
+
+func (m MockWorkModel[T]) GetAll(ctx context.Context, filter WorkFilter, filters Filters) ([]*T, Metadata, error) {
+	return nil, Metadata{}, nil
+}
@@ -0,0 +1,134 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JWK is a public key in JSON Web Key form. Only RSA keys and EC keys on
+// P-256 are understood; others are skipped when a set is parsed.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK returns the JWK of an RSA or P-256 public key.
+func NewJWK(pub crypto.PublicKey, kid string) (JWK, error) {
+	enc := base64.RawURLEncoding
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   enc.EncodeToString(pub.N.Bytes()),
+			E:   enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return JWK{}, errors.New("only P-256 EC keys are supported")
+		}
+		return JWK{
+			Kty: "EC",
+			Kid: kid,
+			Use: "sig",
+			Alg: "ES256",
+			Crv: "P-256",
+			X:   enc.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+			Y:   enc.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported key type %T", pub)
+	}
+}
+
+// PublicKey decodes the key.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !pub.Curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// ParseJWKS returns the signing keys of a JWKS document by key id. Keys
+// meant for encryption and keys of unsupported types are left out.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set JWKS
+	err := json.Unmarshal(data, &set)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		pub, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS holds no usable signing keys")
+	}
+	return keys, nil
+}
@@ -0,0 +1,182 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://issuer.example"
+	testAudience = "library-app"
+)
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func jwksJSON(t *testing.T, keys map[string]crypto.Signer) []byte {
+	t.Helper()
+	var set JWKS
+	for kid, key := range keys {
+		jwk, err := NewJWK(key.Public(), kid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":          "user-1",
+		"email":        "user@example.com",
+		"iss":          testIssuer,
+		"aud":          testAudience,
+		"exp":          time.Now().Add(time.Hour).Unix(),
+		"realm_access": map[string]interface{}{"roles": []string{"librarian"}},
+	}
+}
+
+func sign(t *testing.T, key crypto.Signer, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	token, err := Sign(key, kid, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// unsigned builds a token with alg none, which must never verify.
+func unsigned(t *testing.T, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	headerJSON, _ := json.Marshal(map[string]string{"alg": "none", "kid": kid})
+	claimsJSON, _ := json.Marshal(claims)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(headerJSON) + "." + enc.EncodeToString(claimsJSON) + "."
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey := newRSAKey(t)
+	ecKey := newECKey(t)
+	otherKey := newRSAKey(t)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	err := os.WriteFile(path, jwksJSON(t, map[string]crypto.Signer{"rsa": rsaKey, "ec": ecKey}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &Verifier{
+		Keys:       NewKeySet(path, time.Hour),
+		Issuer:     testIssuer,
+		Audience:   testAudience,
+		RolesClaim: "realm_access.roles",
+		Leeway:     time.Minute,
+	}
+
+	with := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"RS256", sign(t, rsaKey, "rsa", validClaims()), true},
+		{"ES256", sign(t, ecKey, "ec", validClaims()), true},
+		{"audience in a list", sign(t, rsaKey, "rsa", with("aud", []string{"other", testAudience})), true},
+		{"expired within the leeway", sign(t, rsaKey, "rsa", with("exp", time.Now().Add(-30*time.Second).Unix())), true},
+		{"RS256 header on an EC key", sign(t, rsaKey, "ec", validClaims()), false},
+		{"ES256 header on an RSA key", sign(t, ecKey, "rsa", validClaims()), false},
+		{"alg none", unsigned(t, "rsa", validClaims()), false},
+		{"signed by another key", sign(t, otherKey, "rsa", validClaims()), false},
+		{"expired", sign(t, rsaKey, "rsa", with("exp", time.Now().Add(-time.Hour).Unix())), false},
+		{"missing exp", sign(t, rsaKey, "rsa", with("exp", nil)), false},
+		{"not yet valid", sign(t, rsaKey, "rsa", with("nbf", time.Now().Add(time.Hour).Unix())), false},
+		{"wrong issuer", sign(t, rsaKey, "rsa", with("iss", "https://evil.example")), false},
+		{"missing issuer", sign(t, rsaKey, "rsa", with("iss", nil)), false},
+		{"wrong audience", sign(t, rsaKey, "rsa", with("aud", "other")), false},
+		{"missing subject", sign(t, rsaKey, "rsa", with("sub", nil)), false},
+		{"not a JWT", "abc.def", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), tt.token)
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("got %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if claims.Subject != "user-1" || claims.Email != "user@example.com" {
+				t.Errorf("got claims %+v", claims)
+			}
+			if len(claims.Roles) != 1 || claims.Roles[0] != "librarian" {
+				t.Errorf("got roles %v, want [librarian]", claims.Roles)
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedPayload(t *testing.T) {
+	key := newRSAKey(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	err := os.WriteFile(path, jwksJSON(t, map[string]crypto.Signer{"rsa": key}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &Verifier{Keys: NewKeySet(path, time.Hour)}
+
+	token := sign(t, key, "rsa", validClaims())
+	forged := validClaims()
+	forged["sub"] = "admin"
+	forgedJSON, _ := json.Marshal(forged)
+	parts := strings.Split(token, ".")
+	token = parts[0] + "." + base64.RawURLEncoding.EncodeToString(forgedJSON) + "." + parts[2]
+
+	_, err = verifier.Verify(context.Background(), token)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("got %v, want ErrInvalidToken", err)
+	}
+}
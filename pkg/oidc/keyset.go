@@ -0,0 +1,176 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeySet serves the keys of a JWKS read from a file or fetched from an http
+// or https URL. Keys are cached for the refresh interval. A token signed with
+// a key id the set doesn't know triggers an early reload, so that keys
+// rotated in by the issuer are picked up without waiting for the cache to
+// expire. Fetches start at most once per minRefresh, run outside the lock and
+// are shared by the requests that need them; while the source is down the
+// set keeps serving the keys it last loaded.
+type KeySet struct {
+	source     string
+	refresh    time.Duration
+	minRefresh time.Duration
+	client     *http.Client
+
+	mu       sync.Mutex
+	keys     map[string]crypto.PublicKey
+	loadedAt time.Time
+	triedAt  time.Time
+	loadErr  error
+	loading  chan struct{}
+}
+
+func NewKeySet(source string, refresh time.Duration) *KeySet {
+	minRefresh := time.Minute
+	if refresh < minRefresh {
+		minRefresh = refresh
+	}
+	return &KeySet{
+		source:     source,
+		refresh:    refresh,
+		minRefresh: minRefresh,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Key returns the key with the given id. An empty id matches the only key
+// of a set holding one.
+func (s *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	now := time.Now()
+	s.mu.Lock()
+	keys, err := s.keys, s.loadErr
+	expired := keys == nil || now.Sub(s.loadedAt) > s.refresh
+	s.mu.Unlock()
+
+	if expired && s.due(now) {
+		keys, err = s.load(ctx, now)
+	}
+	// Stale keys beat no keys if the source is down for a while.
+	if keys == nil {
+		return nil, err
+	}
+	if key, ok := findKey(keys, kid); ok {
+		return key, nil
+	}
+	if !s.due(now) {
+		// Another request may have loaded the key since keys was read.
+		s.mu.Lock()
+		keys = s.keys
+		s.mu.Unlock()
+		if key, ok := findKey(keys, kid); ok {
+			return key, nil
+		}
+		return nil, ErrUnknownKey
+	}
+	keys, err = s.load(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := findKey(keys, kid); ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func findKey(keys map[string]crypto.PublicKey, kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+// due reports whether a fetch may start, or is already running and can be
+// waited for.
+func (s *KeySet) due(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loading != nil || now.Sub(s.triedAt) >= s.minRefresh
+}
+
+// load fetches the JWKS, or waits for the fetch already running, and returns
+// the keys held afterwards with the error of the fetch. The keys are the
+// stale ones if it failed. The fetch doesn't stop when the request that
+// started it goes away, as other requests may be waiting for it.
+func (s *KeySet) load(ctx context.Context, now time.Time) (map[string]crypto.PublicKey, error) {
+	s.mu.Lock()
+	if loading := s.loading; loading != nil {
+		s.mu.Unlock()
+		select {
+		case <-loading:
+		case <-ctx.Done():
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return s.keys, ctx.Err()
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.keys, s.loadErr
+	}
+	loading := make(chan struct{})
+	s.loading = loading
+	s.triedAt = now
+	s.mu.Unlock()
+
+	keys, err := s.fetch(context.WithoutCancel(ctx))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.keys = keys
+		s.loadedAt = now
+	}
+	s.loadErr = err
+	s.loading = nil
+	close(loading)
+	return s.keys, err
+}
+
+func (s *KeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	data, err := s.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading JWKS from %s: %w", s.source, err)
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("loading JWKS from %s: %w", s.source, err)
+	}
+	return keys, nil
+}
+
+func (s *KeySet) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		return os.ReadFile(s.source)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
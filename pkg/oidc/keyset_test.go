@@ -0,0 +1,101 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jwksServer serves the JWKS of whatever keys holds and counts the fetches.
+type jwksServer struct {
+	mu      sync.Mutex
+	keys    map[string]crypto.Signer
+	fetches atomic.Int32
+}
+
+func (s *jwksServer) set(keys map[string]crypto.Signer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func (s *jwksServer) handler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		data := jwksJSON(t, s.keys)
+		s.mu.Unlock()
+		w.Write(data)
+	})
+}
+
+func TestUnknownKeyRefresh(t *testing.T) {
+	oldKey := newRSAKey(t)
+	newKey := newECKey(t)
+
+	source := &jwksServer{}
+	source.set(map[string]crypto.Signer{"old": oldKey})
+	srv := httptest.NewServer(source.handler(t))
+	defer srv.Close()
+
+	keys := NewKeySet(srv.URL, time.Hour)
+	verifier := &Verifier{Keys: keys}
+	verify := func(key crypto.Signer, kid string) error {
+		_, err := verifier.Verify(context.Background(), sign(t, key, kid, validClaims()))
+		return err
+	}
+	expectFetches := func(want int32) {
+		t.Helper()
+		if got := source.fetches.Load(); got != want {
+			t.Fatalf("got %d fetches, want %d", got, want)
+		}
+	}
+
+	if err := verify(oldKey, "old"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectFetches(1)
+
+	// The issuer rotates a key in, but the set was loaded less than
+	// minRefresh ago, so the unknown kid doesn't fetch again.
+	source.set(map[string]crypto.Signer{"old": oldKey, "new": newKey})
+	if err := verify(newKey, "new"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("got %v, want ErrInvalidToken", err)
+	}
+	expectFetches(1)
+
+	// Once minRefresh has passed, requests with the unknown kid share a
+	// single fetch that picks the new key up.
+	keys.mu.Lock()
+	keys.triedAt = keys.triedAt.Add(-keys.minRefresh)
+	keys.mu.Unlock()
+
+	var wg sync.WaitGroup
+	var accepted atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if verify(newKey, "new") == nil {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	expectFetches(2)
+	if got := accepted.Load(); got != 10 {
+		t.Fatalf("%d of 10 requests accepted the rotated key", got)
+	}
+
+	// A kid nobody knows still only fetches once per minRefresh.
+	if err := verify(newKey, "ghost"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("got %v, want ErrInvalidToken", err)
+	}
+	expectFetches(2)
+}
@@ -1,11 +1,15 @@
 package validator
 
 import (
+	"math"
 	"regexp"
+	"strings"
 )
 
 var (
-	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+	EmailRX  = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+	ISBN10RX = regexp.MustCompile("^[0-9]{9}[0-9X]$")
+	ISBN13RX = regexp.MustCompile("^97[89][0-9]{10}$")
 )
 
 type Validator struct {
@@ -45,6 +49,14 @@ func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
 
+// MaxDecimals reports whether value has at most places decimal places, as
+// far as a float can tell, so that a numeric column of that scale stores it
+// as given.
+func MaxDecimals(value float64, places int) bool {
+	scaled := value * math.Pow10(places)
+	return math.Abs(scaled-math.Round(scaled)) < 1e-6
+}
+
 func Unique(values []string) bool {
 	uniqueValues := make(map[string]bool)
 	for _, value := range values {
@@ -52,3 +64,50 @@ func Unique(values []string) bool {
 	}
 	return len(values) == len(uniqueValues)
 }
+
+// NormalizeISBN strips the hyphens and spaces an ISBN is printed with and
+// upper-cases an x check digit, leaving the form the ISBN checks expect.
+func NormalizeISBN(value string) string {
+	value = strings.NewReplacer("-", "", " ", "").Replace(value)
+	return strings.ToUpper(value)
+}
+
+// ValidISBN10 reports whether a normalised value is an ISBN-10 with the right
+// check digit.
+func ValidISBN10(value string) bool {
+	if !Matches(value, ISBN10RX) {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 10; i++ {
+		digit := int(value[i] - '0')
+		if value[i] == 'X' {
+			digit = 10
+		}
+		sum += (10 - i) * digit
+	}
+	return sum%11 == 0
+}
+
+// ValidISBN13 reports whether a normalised value is an ISBN-13 with the right
+// check digit.
+func ValidISBN13(value string) bool {
+	return Matches(value, ISBN13RX) && isbn13CheckDigit(value[:12]) == value[12]
+}
+
+// ISBN10To13 converts a valid ISBN-10 to the ISBN-13 of the same book.
+func ISBN10To13(value string) string {
+	return "978" + value[:9] + string(isbn13CheckDigit("978"+value[:9]))
+}
+
+func isbn13CheckDigit(first12 string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(first12[i]-'0')
+	}
+	return byte('0' + (10-sum%10)%10)
+}
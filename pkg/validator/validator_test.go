@@ -0,0 +1,53 @@
+package validator
+
+import "testing"
+
+func TestISBN(t *testing.T) {
+	tests := []struct {
+		input      string
+		normalized string
+		isbn10     bool
+		isbn13     bool
+		as13       string
+	}{
+		{"0-306-40615-2", "0306406152", true, false, "9780306406157"},
+		{"0 306 40615 2", "0306406152", true, false, "9780306406157"},
+		{"080442957X", "080442957X", true, false, "9780804429573"},
+		{"0-8044-2957-x", "080442957X", true, false, "9780804429573"},
+		{"0306406153", "0306406153", false, false, ""},
+		{"X306406152", "X306406152", false, false, ""},
+		{"03064X6152", "03064X6152", false, false, ""},
+		{"030640615", "030640615", false, false, ""},
+		{"978-0-306-40615-7", "9780306406157", false, true, ""},
+		{"9780306406158", "9780306406158", false, false, ""},
+		{"979-10-323-0082-4", "9791032300824", false, true, ""},
+		{"9791000000008", "9791000000008", false, true, ""},
+		{"9770306406157", "9770306406157", false, false, ""},
+		{"978030640615X", "978030640615X", false, false, ""},
+		{"", "", false, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			normalized := NormalizeISBN(tt.input)
+			if normalized != tt.normalized {
+				t.Fatalf("NormalizeISBN(%q) = %q, want %q", tt.input, normalized, tt.normalized)
+			}
+			if got := ValidISBN10(normalized); got != tt.isbn10 {
+				t.Errorf("ValidISBN10(%q) = %t, want %t", normalized, got, tt.isbn10)
+			}
+			if got := ValidISBN13(normalized); got != tt.isbn13 {
+				t.Errorf("ValidISBN13(%q) = %t, want %t", normalized, got, tt.isbn13)
+			}
+			if tt.isbn10 {
+				as13 := ISBN10To13(normalized)
+				if as13 != tt.as13 {
+					t.Errorf("ISBN10To13(%q) = %q, want %q", normalized, as13, tt.as13)
+				}
+				if !ValidISBN13(as13) {
+					t.Errorf("ISBN10To13(%q) = %q, which is not a valid ISBN-13", normalized, as13)
+				}
+			}
+		})
+	}
+}